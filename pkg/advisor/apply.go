@@ -0,0 +1,262 @@
+package advisor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+)
+
+// FieldManager is the server-side apply field manager used when modifying workloads.
+const FieldManager = "resource-advisor"
+
+// Supported dry-run modes.
+const (
+	DryRunNone   = "none"
+	DryRunServer = "server"
+)
+
+// Apply statuses of a workload.
+const (
+	ApplyStatusApplied   = "applied"
+	ApplyStatusDryRun    = "dry-run"
+	ApplyStatusSkipped   = "skipped"
+	ApplyStatusUnchanged = "unchanged"
+	ApplyStatusFailed    = "failed"
+)
+
+// ApplyOptions contains struct to call resource-advisor apply.
+type ApplyOptions struct {
+	*Options
+	DryRun         string    // none or server, defaults to none
+	AssumeYes      bool      // apply without asking confirmation for each workload
+	ForceConflicts bool      // take ownership of fields managed by other field managers
+	In             io.Reader // confirmations are read from here, defaults to os.Stdin
+}
+
+// ApplyResult contains the outcome of applying recommendations to a single workload.
+type ApplyResult struct {
+	RunID           string
+	Namespace       string
+	Kind            string
+	Name            string
+	Status          string
+	Error           error
+	Recommendations []Recommendation
+}
+
+func (o *ApplyOptions) loadDefaults() {
+	o.Options.loadDefaults()
+	if o.DryRun == "" {
+		o.DryRun = DryRunNone
+	}
+	if o.In == nil {
+		o.In = os.Stdin
+	}
+}
+
+// Apply writes the recommended requests and limits to the workloads using server-side apply.
+func Apply(o *ApplyOptions) ([]ApplyResult, error) {
+	o.loadDefaults()
+	if o.DryRun != DryRunNone && o.DryRun != DryRunServer {
+		return nil, fmt.Errorf("unsupported dry-run mode '%s', supported modes are %s and %s", o.DryRun, DryRunNone, DryRunServer)
+	}
+
+	ctx := context.Background()
+	resp, err := o.analyze(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        o.ForceConflicts,
+	}
+	if o.DryRun == DryRunServer {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	runID := newRunID()
+	appliedAt := time.Now().UTC()
+	in := bufio.NewReader(o.In)
+	results := []ApplyResult{}
+	failed := 0
+	for _, workload := range groupByWorkload(resp.Recommendations) {
+		annotation, err := previousResourcesAnnotation(runID, appliedAt, workload.Recommendations)
+		if err != nil {
+			return nil, err
+		}
+		workload.Annotations = map[string]string{PreviousResourcesAnnotation: annotation}
+
+		result := ApplyResult{
+			RunID:           runID,
+			Namespace:       workload.Namespace,
+			Kind:            workload.Kind,
+			Name:            workload.Name,
+			Recommendations: workload.Recommendations,
+		}
+		switch {
+		case !workload.changed():
+			result.Status = ApplyStatusUnchanged
+		case !o.AssumeYes && !o.confirm(in, workload):
+			result.Status = ApplyStatusSkipped
+		default:
+			result.Status = ApplyStatusApplied
+			if o.DryRun == DryRunServer {
+				result.Status = ApplyStatusDryRun
+			}
+			if err := o.applyWorkload(ctx, workload, opts); err != nil {
+				result.Status = ApplyStatusFailed
+				result.Error = err
+				failed++
+			}
+		}
+		results = append(results, result)
+	}
+
+	fmt.Fprintf(o.Out, "Run ID: %s\n", runID)
+	if err := renderApplySummary(o.Out, results); err != nil {
+		return results, err
+	}
+	for _, warning := range resp.Warnings {
+		fmt.Fprintf(o.Out, "Warning: %s\n", warning)
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("failed to apply %d workloads", failed)
+	}
+	return results, nil
+}
+
+// changed reports whether applying the recommendations would modify the workload.
+func (w workloadRecommendations) changed() bool {
+	for _, rec := range w.Recommendations {
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			if !quantityEqual(rec.Current.Requests, rec.Recommended.Requests, name) ||
+				!quantityEqual(rec.Current.Limits, rec.Recommended.Limits, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func quantityEqual(a v1.ResourceList, b v1.ResourceList, name v1.ResourceName) bool {
+	qa, okA := a[name]
+	qb, okB := b[name]
+	return okA == okB && qa.Cmp(qb) == 0
+}
+
+func (o *ApplyOptions) confirm(in *bufio.Reader, workload workloadRecommendations) bool {
+	fmt.Fprintf(o.Out, "%s/%s in namespace %s:\n", workload.Kind, workload.Name, workload.Namespace)
+	for _, rec := range workload.Recommendations {
+		fmt.Fprintf(o.Out, "  %s: requests cpu %s, memory %s, limits cpu %s, memory %s\n",
+			tableContainer(rec.Container, rec.ContainerType),
+			change(rec.Current.Requests, rec.Recommended.Requests, v1.ResourceCPU),
+			change(rec.Current.Requests, rec.Recommended.Requests, v1.ResourceMemory),
+			change(rec.Current.Limits, rec.Recommended.Limits, v1.ResourceCPU),
+			change(rec.Current.Limits, rec.Recommended.Limits, v1.ResourceMemory),
+		)
+	}
+	fmt.Fprintf(o.Out, "Apply changes? [y/N]: ")
+	answer, _ := in.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func (o *ApplyOptions) applyWorkload(ctx context.Context, workload workloadRecommendations, opts metav1.ApplyOptions) error {
+	cfg, err := workload.applyConfiguration()
+	if err != nil {
+		return err
+	}
+	switch c := cfg.(type) {
+	case *appsv1ac.DeploymentApplyConfiguration:
+		_, err = o.Client.AppsV1().Deployments(workload.Namespace).Apply(ctx, c, opts)
+	case *appsv1ac.StatefulSetApplyConfiguration:
+		_, err = o.Client.AppsV1().StatefulSets(workload.Namespace).Apply(ctx, c, opts)
+	case *appsv1ac.DaemonSetApplyConfiguration:
+		_, err = o.Client.AppsV1().DaemonSets(workload.Namespace).Apply(ctx, c, opts)
+	case *batchv1ac.CronJobApplyConfiguration:
+		_, err = o.Client.BatchV1().CronJobs(workload.Namespace).Apply(ctx, c, opts)
+	default:
+		err = fmt.Errorf("unsupported apply configuration %T", cfg)
+	}
+	if err != nil || !workload.removesLimits() {
+		return err
+	}
+
+	// server-side apply removes only limits applied earlier by the advisor, so limits set by
+	// others are removed with a strategic merge patch
+	patch, err := workload.strategicPatch()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch for %s/%s: %w", workload.Kind, workload.Name, err)
+	}
+	patchOpts := metav1.PatchOptions{FieldManager: opts.FieldManager, DryRun: opts.DryRun}
+	switch workload.Kind {
+	case KindDeployment:
+		_, err = o.Client.AppsV1().Deployments(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, data, patchOpts)
+	case KindStatefulSet:
+		_, err = o.Client.AppsV1().StatefulSets(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, data, patchOpts)
+	case KindDaemonSet:
+		_, err = o.Client.AppsV1().DaemonSets(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, data, patchOpts)
+	case KindCronJob:
+		_, err = o.Client.BatchV1().CronJobs(workload.Namespace).Patch(ctx, workload.Name, types.StrategicMergePatchType, data, patchOpts)
+	}
+	return err
+}
+
+// change formats the change of a single value as "current -> recommended".
+func change(current v1.ResourceList, recommended v1.ResourceList, name v1.ResourceName) string {
+	value := reportValue(current, recommended, name)
+	return fmt.Sprintf("%s -> %s", tableValue(value.Current), tableValue(value.Recommended))
+}
+
+func renderApplySummary(w io.Writer, results []ApplyResult) error {
+	table := tablewriter.NewWriter(w)
+	table.Header("Namespace", "Resource", "Container", "Request CPU", "Request MEM", "Limit CPU", "Limit MEM", "Status")
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		status := result.Status
+		if result.Error != nil {
+			status = fmt.Sprintf("%s: %v", status, result.Error)
+		}
+		for _, rec := range result.Recommendations {
+			_ = table.Append([]string{
+				rec.Namespace,
+				fmt.Sprintf("%s/%s", rec.Kind, rec.Name),
+				tableContainer(rec.Container, rec.ContainerType),
+				change(rec.Current.Requests, rec.Recommended.Requests, v1.ResourceCPU),
+				change(rec.Current.Requests, rec.Recommended.Requests, v1.ResourceMemory),
+				change(rec.Current.Limits, rec.Recommended.Limits, v1.ResourceCPU),
+				change(rec.Current.Limits, rec.Recommended.Limits, v1.ResourceMemory),
+				status,
+			})
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("failed to render table: %w", err)
+	}
+	fmt.Fprintf(w, "Workloads %s: %d, %s: %d, %s: %d, %s: %d, %s: %d\n",
+		ApplyStatusApplied, counts[ApplyStatusApplied],
+		ApplyStatusDryRun, counts[ApplyStatusDryRun],
+		ApplyStatusUnchanged, counts[ApplyStatusUnchanged],
+		ApplyStatusSkipped, counts[ApplyStatusSkipped],
+		ApplyStatusFailed, counts[ApplyStatusFailed],
+	)
+	return nil
+}
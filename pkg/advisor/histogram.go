@@ -0,0 +1,160 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+)
+
+// Buckets of the usage histograms. The buckets grow exponentially such that the relative error of
+// a percentile is the same for small and large containers.
+const (
+	histogramRatio    = 1.05
+	histogramFirstCPU = 0.01    // cores
+	histogramMaxCPU   = 1000    // cores
+	histogramFirstMem = 10      // mebibytes
+	histogramMaxMem   = 1 << 20 // mebibytes
+	defaultHalfLife   = 24 * time.Hour
+	defaultPercentile = 0.9
+	defaultMargin     = 1.15
+)
+
+// HistogramOptions configures the histogram strategy.
+type HistogramOptions struct {
+	HalfLife   time.Duration // age at which a sample has half the weight of a current one, defaults to 24h
+	Percentile float64       // percentile of the weighted usage requested, defaults to 0.9
+	Margin     float64       // multiplier of the percentile, defaults to 1.15
+}
+
+func (h *HistogramOptions) loadDefaults() {
+	if h.HalfLife == 0 {
+		h.HalfLife = defaultHalfLife
+	}
+	if h.Percentile == 0 {
+		h.Percentile = defaultPercentile
+	}
+	if h.Margin == 0 {
+		h.Margin = defaultMargin
+	}
+}
+
+func (h HistogramOptions) validate() error {
+	if h.HalfLife < 0 {
+		return fmt.Errorf("histogram half-life must be positive, got %s", h.HalfLife)
+	}
+	if h.Percentile < 0 || h.Percentile > 1 {
+		return fmt.Errorf("histogram percentile must be between 0 and 1, got %g", h.Percentile)
+	}
+	if h.Margin < 0 {
+		return fmt.Errorf("histogram margin must be positive, got %g", h.Margin)
+	}
+	return nil
+}
+
+// String returns the settings shown in the report.
+func (h HistogramOptions) String() string {
+	return fmt.Sprintf("half-life %s, percentile %g, margin %g", prommodel.Duration(h.HalfLife), h.Percentile, h.Margin)
+}
+
+// histogramRecommender requests a percentile of the usage samples weighted by their age, similar to
+// the recommender of the Kubernetes vertical pod autoscaler. The weight of a sample halves every
+// half-life, so recent usage counts more than a spike from the beginning of the window. Limits are
+// the peak usage multiplied by the limit margin, or the request when it is higher.
+type histogramRecommender struct {
+	o      *Options
+	margin float64 // limit margin
+}
+
+func (histogramRecommender) NeedsSamples() bool {
+	return true
+}
+
+func (h histogramRecommender) Recommend(_ context.Context, _ Workload, usage Usage) (map[string]ContainerResources, error) {
+	if usage.Samples == nil {
+		return nil, fmt.Errorf("histogram strategy requires usage samples")
+	}
+
+	containers := usage.containers()
+	for container := range usage.Samples.CPU {
+		containers = append(containers, container)
+	}
+	for container := range usage.Samples.Memory {
+		containers = append(containers, container)
+	}
+
+	resources := map[string]ContainerResources{}
+	for _, container := range containers {
+		if _, ok := resources[container]; ok {
+			continue
+		}
+		requestCPU := h.percentile(histogramFirstCPU, histogramMaxCPU, usage.Samples.CPU[container])
+		requestMem := h.percentile(histogramFirstMem, histogramMaxMem, usage.Samples.Memory[container])
+		resources[container] = ContainerResources{
+			RequestCPU: requestCPU,
+			RequestMem: requestMem,
+			LimitCPU:   math.Max(requestCPU, usage.LimitCPU[container]*h.margin),
+			LimitMem:   math.Max(requestMem, usage.LimitMem[container]*h.margin),
+		}
+	}
+	return resources, nil
+}
+
+// percentile returns the weighted percentile of the samples multiplied by the margin.
+func (h histogramRecommender) percentile(first float64, maxValue float64, samples []Sample) float64 {
+	histogram := newDecayingHistogram(first, maxValue)
+	for _, sample := range samples {
+		// samples at the evaluation time have full weight, later samples do not weigh more
+		age := max(0, h.o.at.Sub(sample.Time))
+		histogram.add(sample.Value, math.Exp2(-age.Seconds()/h.o.Histogram.HalfLife.Seconds()))
+	}
+	return histogram.percentile(h.o.Histogram.Percentile) * h.o.Histogram.Margin
+}
+
+// decayingHistogram contains the total weight of the samples in each bucket. The first bucket
+// covers values below first and bucket i values up to first * ratio^i.
+type decayingHistogram struct {
+	first   float64
+	weights []float64
+	total   float64
+}
+
+func newDecayingHistogram(first float64, maxValue float64) *decayingHistogram {
+	buckets := int(math.Ceil(math.Log(maxValue/first)/math.Log(histogramRatio))) + 1
+	return &decayingHistogram{first: first, weights: make([]float64, buckets)}
+}
+
+func (d *decayingHistogram) bucket(value float64) int {
+	if value < d.first {
+		return 0
+	}
+	bucket := int(math.Floor(math.Log(value/d.first)/math.Log(histogramRatio))) + 1
+	return min(bucket, len(d.weights)-1)
+}
+
+func (d *decayingHistogram) add(value float64, weight float64) {
+	if math.IsNaN(value) || weight <= 0 {
+		return
+	}
+	d.weights[d.bucket(value)] += weight
+	d.total += weight
+}
+
+// percentile returns the upper bound of the bucket containing the percentile, or zero without
+// samples.
+func (d *decayingHistogram) percentile(percentile float64) float64 {
+	if d.total == 0 {
+		return 0
+	}
+	threshold := percentile * d.total
+	cumulative := 0.0
+	for i, weight := range d.weights {
+		cumulative += weight
+		if weight > 0 && cumulative >= threshold {
+			return d.first * math.Pow(histogramRatio, float64(i))
+		}
+	}
+	return d.first * math.Pow(histogramRatio, float64(len(d.weights)-1))
+}
@@ -0,0 +1,101 @@
+package advisor
+
+import (
+	"context"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDecayingHistogram(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		values     []float64
+		weights    []float64
+		percentile float64
+		expected   float64
+	}{
+		{"no samples", nil, nil, 0.9, 0},
+		{"equal weights", []float64{1, 1, 1, 10}, []float64{1, 1, 1, 1}, 0.9, 10},
+		{"old spike", []float64{1, 1, 1, 10}, []float64{1, 1, 1, 0.01}, 0.9, 1},
+		{"below the first bucket", []float64{0.001}, []float64{1}, 0.5, histogramFirstCPU},
+		{"not a number", []float64{math.NaN()}, []float64{1}, 0.5, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			histogram := newDecayingHistogram(histogramFirstCPU, histogramMaxCPU)
+			for i, value := range tc.values {
+				histogram.add(value, tc.weights[i])
+			}
+			actual := histogram.percentile(tc.percentile)
+			// the upper bound of the bucket is at most one bucket above the value
+			if actual < tc.expected || actual > tc.expected*histogramRatio {
+				t.Errorf("expected %g, got %g", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHistogram(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := Samples{CPU: map[string][]Sample{}, Memory: map[string][]Sample{}}
+	// a steady usage of the last day and a spike a week ago
+	for i := range 9 {
+		samples.CPU["app"] = append(samples.CPU["app"], Sample{Time: at.Add(-time.Duration(i) * time.Hour), Value: 0.2})
+		samples.Memory["app"] = append(samples.Memory["app"], Sample{Time: at.Add(-time.Duration(i) * time.Hour), Value: 200})
+	}
+	samples.CPU["app"] = append(samples.CPU["app"], Sample{Time: at.Add(-7 * 24 * time.Hour), Value: 2})
+	samples.Memory["app"] = append(samples.Memory["app"], Sample{Time: at.Add(-7 * 24 * time.Hour), Value: 2000})
+	source := fakeSampleSource{fakeSource: fakeSource{web: webUsage()}, samples: map[Workload]Samples{web: samples}}
+
+	for _, tc := range []struct {
+		name     string
+		source   MetricsSource
+		halfLife time.Duration
+		cpu      string
+		memory   string
+		limitCPU string
+		err      string
+	}{
+		{name: "spike decayed", source: source, cpu: "300m", memory: "300Mi", limitCPU: "400m"},
+		{name: "spike kept", source: source, halfLife: 1000 * time.Hour, cpu: "2400m", memory: "2400Mi", limitCPU: "2400m"},
+		{name: "source without samples", source: fakeSource{web: webUsage()}, err: "strategy histogram requires usage samples"},
+		{name: "invalid half-life", source: source, halfLife: -time.Hour, err: "histogram half-life must be positive"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{
+				Namespaces: "ns",
+				At:         at.Format(time.RFC3339),
+				Strategy:   StrategyHistogram,
+				Histogram:  HistogramOptions{HalfLife: tc.halfLife, Percentile: 0.95},
+				Client:     fake.NewClientset(webDeployment()),
+				Metrics:    tc.source,
+				Out:        io.Discard,
+			}
+			o.loadDefaults()
+			resp, err := o.analyze(context.Background())
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := recommendationOf(t, resp, "app")
+			assertQuantity(t, "requests", app.Recommended.Requests, v1.ResourceCPU, tc.cpu)
+			assertQuantity(t, "requests", app.Recommended.Requests, v1.ResourceMemory, tc.memory)
+			// the limit is the peak usage with the limit margin unless the request is higher
+			limit := app.Recommended.Limits[v1.ResourceCPU]
+			if limit.Cmp(resource.MustParse(tc.limitCPU)) != 0 {
+				t.Errorf("expected cpu limit %s, got %s", tc.limitCPU, limit.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package advisor
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Limit policies.
+const (
+	LimitPolicyMargin  = "margin"  // peak usage multiplied by the limit margin
+	LimitPolicyNone    = "none"    // no limit
+	LimitPolicyRequest = "request" // equal to the recommended request
+	LimitPolicyRatio   = "ratio"   // recommended request multiplied by the ratio
+	LimitPolicyCurrent = "current" // the limit currently in the workload spec
+)
+
+// QoS classes of pods.
+const (
+	QoSGuaranteed = "Guaranteed"
+	QoSBurstable  = "Burstable"
+	QoSBestEffort = "BestEffort"
+)
+
+// LimitPolicy selects how the limits of cpu and memory are recommended.
+type LimitPolicy struct {
+	CPU         string  // one of the LimitPolicy constants, defaults to margin
+	Memory      string  // one of the LimitPolicy constants, defaults to margin
+	CPURatio    float64 // limit as a multiple of the request with the ratio policy
+	MemoryRatio float64 // limit as a multiple of the request with the ratio policy
+}
+
+func (l *LimitPolicy) loadDefaults() {
+	if l.CPU == "" {
+		l.CPU = LimitPolicyMargin
+	}
+	if l.Memory == "" {
+		l.Memory = LimitPolicyMargin
+	}
+}
+
+func (l LimitPolicy) validate() error {
+	for _, resource := range []struct {
+		name   string
+		policy string
+		ratio  float64
+	}{
+		{"cpu", l.CPU, l.CPURatio},
+		{"memory", l.Memory, l.MemoryRatio},
+	} {
+		switch resource.policy {
+		case LimitPolicyMargin, LimitPolicyNone, LimitPolicyRequest, LimitPolicyCurrent:
+		case LimitPolicyRatio:
+			if resource.ratio < 1 {
+				return fmt.Errorf("%s limit ratio must be at least 1 with the %s policy, got %g", resource.name, LimitPolicyRatio, resource.ratio)
+			}
+		default:
+			return fmt.Errorf("unsupported %s limit policy '%s', supported policies are %s, %s, %s, %s and %s",
+				resource.name, resource.policy, LimitPolicyMargin, LimitPolicyNone, LimitPolicyRequest, LimitPolicyRatio, LimitPolicyCurrent)
+		}
+	}
+	return nil
+}
+
+// String returns the policies shown in the report.
+func (l LimitPolicy) String() string {
+	format := func(policy string, ratio float64) string {
+		if policy == LimitPolicyRatio {
+			return fmt.Sprintf("%s %g", policy, ratio)
+		}
+		return policy
+	}
+	return fmt.Sprintf("cpu %s, memory %s", format(l.CPU, l.CPURatio), format(l.Memory, l.MemoryRatio))
+}
+
+// limits returns the recommended limits of the container. Resources without a limit are left out.
+func (o *Options) limits(namespace string, container v1.Container, resources ContainerResources) v1.ResourceList {
+	cpuRounding, memoryRounding := o.rounding.rules(namespace, container.Name)
+	limits := v1.ResourceList{}
+	for _, r := range []struct {
+		name     v1.ResourceName
+		policy   string
+		ratio    float64
+		request  float64
+		limit    float64
+		rounding rounding
+		round    func(float64) float64
+		quantity func(float64) resource.Quantity
+	}{
+		{v1.ResourceCPU, o.LimitPolicy.CPU, o.LimitPolicy.CPURatio, resources.RequestCPU, resources.LimitCPU, cpuRounding, roundCPU, cpuQuantity},
+		{v1.ResourceMemory, o.LimitPolicy.Memory, o.LimitPolicy.MemoryRatio, resources.RequestMem, resources.LimitMem, memoryRounding, roundMemory, memoryQuantity},
+	} {
+		switch r.policy {
+		case LimitPolicyNone:
+		case LimitPolicyCurrent:
+			// a limit below the request is rejected by the API server, so the current limit is
+			// raised to the recommended request
+			if current, ok := container.Resources.Limits[r.name]; ok {
+				limits[r.name] = current.DeepCopy()
+				if request := r.quantity(r.request); current.Cmp(request) < 0 {
+					limits[r.name] = request
+				}
+			}
+		case LimitPolicyRequest:
+			limits[r.name] = r.quantity(r.request)
+		case LimitPolicyRatio:
+			limits[r.name] = r.quantity(r.rounding.round(r.request*r.ratio, r.round))
+		default:
+			limits[r.name] = r.quantity(r.limit)
+		}
+	}
+	return limits
+}
+
+// qosClass returns the QoS class of a pod with the resources of its containers. Only cpu and
+// memory are considered like Kubernetes does.
+func qosClass(containers []v1.ResourceRequirements) string {
+	guaranteed := true
+	bestEffort := true
+	for _, resources := range containers {
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			request, hasRequest := resources.Requests[name]
+			limit, hasLimit := resources.Limits[name]
+			if hasRequest || hasLimit {
+				bestEffort = false
+			}
+			// a missing request defaults to the limit
+			if !hasLimit || (hasRequest && request.Cmp(limit) != 0) {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case bestEffort:
+		return QoSBestEffort
+	case guaranteed:
+		return QoSGuaranteed
+	}
+	return QoSBurstable
+}
+
+// qosWarnings returns a warning for every workload whose pods would get another QoS class with the
+// recommendations. Containers without usage keep their current resources.
+func qosWarnings(recommendations []Recommendation) []string {
+	warnings := []string{}
+	for start := 0; start < len(recommendations); {
+		end := start + 1
+		for end < len(recommendations) && sameWorkload(recommendations[start], recommendations[end]) {
+			end++
+		}
+		current := []v1.ResourceRequirements{}
+		recommended := []v1.ResourceRequirements{}
+		for _, rec := range recommendations[start:end] {
+			current = append(current, rec.Current)
+			if hasUsage(rec) {
+				recommended = append(recommended, rec.Recommended)
+			} else {
+				recommended = append(recommended, rec.Current)
+			}
+		}
+		if from, to := qosClass(current), qosClass(recommended); from != to {
+			rec := recommendations[start]
+			warnings = append(warnings, fmt.Sprintf("%s/%s in namespace %s would change QoS class from %s to %s", rec.Kind, rec.Name, rec.Namespace, from, to))
+		}
+		start = end
+	}
+	return warnings
+}
+
+func sameWorkload(a Recommendation, b Recommendation) bool {
+	return a.Namespace == b.Namespace && a.Kind == b.Kind && a.Name == b.Name
+}
@@ -0,0 +1,99 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAnalyzeLimitPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		policy      LimitPolicy
+		container   string
+		usage       func(*Usage)
+		cpuLimit    string
+		memoryLimit string
+	}{
+		{name: "margin", container: "app", cpuLimit: "400m", memoryLimit: "600Mi"},
+		{name: "none", policy: LimitPolicy{CPU: LimitPolicyNone, Memory: LimitPolicyNone}, container: "app"},
+		{name: "request", policy: LimitPolicy{CPU: LimitPolicyRequest, Memory: LimitPolicyRequest}, container: "app", cpuLimit: "200m", memoryLimit: "300Mi"},
+		{name: "ratio", policy: LimitPolicy{CPU: LimitPolicyRatio, CPURatio: 2, Memory: LimitPolicyRatio, MemoryRatio: 1.5}, container: "app", cpuLimit: "400m", memoryLimit: "500Mi"},
+		{name: "current", policy: LimitPolicy{CPU: LimitPolicyCurrent, Memory: LimitPolicyCurrent}, container: "app", cpuLimit: "1", memoryLimit: "2Gi"},
+		{name: "current below the request", policy: LimitPolicy{CPU: LimitPolicyCurrent, Memory: LimitPolicyCurrent}, container: "app", usage: func(u *Usage) {
+			u.RequestCPU["app"], u.RequestMem["app"] = 1.5, 3000
+		}, cpuLimit: "1500m", memoryLimit: "3000Mi"},
+		{name: "current unset", policy: LimitPolicy{CPU: LimitPolicyCurrent, Memory: LimitPolicyCurrent}, container: "proxy"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			usage := webUsage()
+			if tc.usage != nil {
+				tc.usage(&usage)
+			}
+			resp := analyzeFake(t, &Options{LimitPolicy: tc.policy}, fakeSource{web: usage}, webDeployment())
+			limits := recommendationOf(t, resp, tc.container).Recommended.Limits
+			assertQuantity(t, "limits", limits, v1.ResourceCPU, tc.cpuLimit)
+			assertQuantity(t, "limits", limits, v1.ResourceMemory, tc.memoryLimit)
+		})
+	}
+}
+
+func TestQoSClass(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		containers []v1.ResourceRequirements
+		expected   string
+	}{
+		{"no resources", []v1.ResourceRequirements{{}, {}}, QoSBestEffort},
+		{"requests equal limits", []v1.ResourceRequirements{
+			{Requests: resourceList("100m", "100Mi"), Limits: resourceList("100m", "100Mi")},
+			{Requests: resourceList("1", "1Gi"), Limits: resourceList("1000m", "1024Mi")},
+		}, QoSGuaranteed},
+		{"missing requests default to limits", []v1.ResourceRequirements{
+			{Limits: resourceList("100m", "100Mi")},
+		}, QoSGuaranteed},
+		{"request below limit", []v1.ResourceRequirements{
+			{Requests: resourceList("100m", "100Mi"), Limits: resourceList("200m", "100Mi")},
+		}, QoSBurstable},
+		{"missing memory limit", []v1.ResourceRequirements{
+			{Requests: resourceList("100m", "100Mi"), Limits: resourceList("100m", "")},
+		}, QoSBurstable},
+		{"one container without resources", []v1.ResourceRequirements{
+			{Requests: resourceList("100m", "100Mi"), Limits: resourceList("100m", "100Mi")},
+			{},
+		}, QoSBurstable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := qosClass(tc.containers); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAnalyzeQoSWarnings(t *testing.T) {
+	deployment := webDeployment()
+	deployment.Spec.Template.Spec.InitContainers = nil
+	deployment.Spec.Template.Spec.Containers[0].Resources = v1.ResourceRequirements{
+		Requests: resourceList("1", "1Gi"),
+		Limits:   resourceList("1", "1Gi"),
+	}
+
+	for _, tc := range []struct {
+		name     string
+		policy   LimitPolicy
+		warnings []string
+	}{
+		{"margin", LimitPolicy{}, []string{"deployment/web in namespace ns would change QoS class from Guaranteed to Burstable"}},
+		{"request", LimitPolicy{CPU: LimitPolicyRequest, Memory: LimitPolicyRequest}, []string{}},
+		{"none", LimitPolicy{CPU: LimitPolicyNone, Memory: LimitPolicyNone}, []string{"deployment/web in namespace ns would change QoS class from Guaranteed to Burstable"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := analyzeFake(t, &Options{LimitPolicy: tc.policy}, fakeSource{web: webUsage()}, deployment)
+			if !reflect.DeepEqual(resp.Warnings, tc.warnings) {
+				t.Errorf("expected warnings %v, got %v", tc.warnings, resp.Warnings)
+			}
+		})
+	}
+}
@@ -2,14 +2,20 @@ package advisor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/olekukonko/tablewriter"
+	prommodel "github.com/prometheus/common/model"
+	"golang.org/x/sync/errgroup"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
-	apresource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func (o *Options) loadDefaults() {
@@ -19,197 +25,431 @@ func (o *Options) loadDefaults() {
 	if o.LimitMargin == "" {
 		o.LimitMargin = "1.2"
 	}
+	if o.Window == "" {
+		o.Window = "1w"
+		o.defaultWindow = true
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = 4
+	}
+	// namespaces and the queries of each namespace run in parallel, so without a limit up to the
+	// square of the concurrency queries could be running at the same time
+	if o.Prometheus.MaxInFlight == 0 {
+		o.Prometheus.MaxInFlight = o.Concurrency
+	}
+	if o.Source == "" {
+		o.Source = SourceAuto
+	}
+	if o.Strategy == "" {
+		o.Strategy = StrategyQuantile
+	}
+	o.Histogram.loadDefaults()
+	o.LimitPolicy.loadDefaults()
+	o.Risk.loadDefaults()
+	if o.SampleDuration == 0 {
+		o.SampleDuration = 5 * time.Minute
+	}
+	if o.Prometheus.Timeout == 0 {
+		o.Prometheus.Timeout = 5 * time.Minute
+	}
+	if o.Output == "" {
+		o.Output = OutputTable
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	if o.PatchFormat == "" {
+		o.PatchFormat = PatchStrategic
+	}
 }
 
 // Run executes the resource advisor.
 func Run(o *Options) (*Response, error) {
 	o.loadDefaults()
-	var err error
-	if o.Client == nil {
-		o.Client, err = newClientSet()
-		if err != nil {
+	err := validateOutput(o.Output)
+	if err != nil {
+		return nil, err
+	}
+	err = o.validatePatches()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.analyze(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.render(o.Out, resp); err != nil {
+		return nil, err
+	}
+	if o.PatchFile != "" || o.PatchDir != "" {
+		if err := o.writePatches(resp.Recommendations); err != nil {
 			return nil, err
 		}
 	}
+	return resp, nil
+}
 
-	ctx := context.Background()
-	o.promClient, err = makeClientForCluster(ctx, o)
+// analyze builds the recommendations for all workloads in the used namespaces.
+func (o *Options) analyze(ctx context.Context) (*Response, error) {
+	err := o.Prometheus.validate()
 	if err != nil {
 		return nil, err
 	}
-
-	o.mode, err = o.detectMode(ctx)
+	if o.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", o.Concurrency)
+	}
+	switch o.Source {
+	case SourceAuto, SourcePrometheus, SourceMetricsServer:
+	default:
+		return nil, fmt.Errorf("unsupported metrics source '%s', supported sources are %s, %s and %s", o.Source, SourceAuto, SourcePrometheus, SourceMetricsServer)
+	}
+	if window, err := prommodel.ParseDuration(o.Window); err != nil || window == 0 {
+		return nil, fmt.Errorf("invalid window '%s', expected for example 3d, 2w or 30d", o.Window)
+	}
+	if o.QueryConfig != "" {
+		o.Queries, err = loadQueryTemplates(o.QueryConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := o.Queries.validate(); err != nil {
+		return nil, err
+	}
+	o.recommender, err = o.newRecommender()
 	if err != nil {
 		return nil, err
 	}
-
-	o.usedNamespaces, err = buildUsedNamespaces(ctx, o)
+	if o.RoundingConfig != "" {
+		o.Rounding, err = loadRoundingPolicy(o.RoundingConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	o.rounding, err = o.Rounding.compile()
 	if err != nil {
 		return nil, err
 	}
+	if err := o.LimitPolicy.validate(); err != nil {
+		return nil, err
+	}
+	if err := o.Risk.validate(); err != nil {
+		return nil, err
+	}
+	// every query uses the same evaluation time such that the results are consistent
+	o.at, err = evaluationTime(o.At)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.validateRecording(); err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("Namespaces: %s\n", o.usedNamespaces)
-	fmt.Printf("Quantile: %s\n", o.Quantile)
-	fmt.Printf("Limit margin: %s\n", o.LimitMargin)
-	fmt.Printf("Using mode: %s\n", o.mode)
-
-	data := [][]string{}
-
-	totalCPUSave := float64(0.00)
-	totalMemSave := float64(0.00)
-	for _, namespace := range strings.Split(o.usedNamespaces, ",") {
-		var cpuSave, memSave float64
-		data, cpuSave, memSave, err = o.handleDeployments(ctx, namespace, data)
+	var metrics MetricsSource
+	if o.Replay != "" {
+		metrics, err = o.loadRecording()
 		if err != nil {
 			return nil, err
 		}
-		totalCPUSave += cpuSave
-		totalMemSave += memSave
-
-		data, cpuSave, memSave, err = o.handleStatefulsets(ctx, namespace, data)
+	} else {
+		metrics, err = o.setup(ctx)
 		if err != nil {
 			return nil, err
 		}
-		totalCPUSave += cpuSave
-		totalMemSave += memSave
-
-		data, cpuSave, memSave, err = o.handleDaemonsets(ctx, namespace, data)
+	}
+	namespaces := strings.Split(o.usedNamespaces, ",")
+	if o.Record != "" {
+		recorded, err := o.recordWorkloads(ctx, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		sampled, err := o.recordSamples(ctx, metrics, namespaces)
 		if err != nil {
 			return nil, err
 		}
-		totalCPUSave += cpuSave
-		totalMemSave += memSave
+		if err := o.writeRecording(namespaces, recorded, sampled); err != nil {
+			return nil, err
+		}
+		// the run is analyzed from the recorded samples like the replay
+		metrics = sampled
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.Header("Namespace", "Resource", "Container", "Request CPU (spec)", "Request MEM (spec)", "Limit CPU (spec)", "Limit MEM (spec)")
-	for _, v := range data {
-		_ = table.Append(v)
+	// every namespace gets its own slot such that the order does not depend on completion order
+	results := make([][]Recommendation, len(namespaces))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(o.Concurrency)
+	for i, namespace := range namespaces {
+		group.Go(func() error {
+			var err error
+			results[i], err = o.analyzeNamespace(groupCtx, metrics, namespace)
+			return err
+		})
 	}
-	if err := table.Render(); err != nil {
-		return nil, fmt.Errorf("failed to render table: %w", err)
+	if err := group.Wait(); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Total savings:\n")
+	recommendations := []Recommendation{}
+	for _, result := range results {
+		recommendations = append(recommendations, result...)
+	}
+
+	totalCPUSave := float64(0.00)
+	totalMemSave := float64(0.00)
+	for _, rec := range recommendations {
+		// pods of cronjobs and jobs do not run continuously, so their savings are not comparable
+		// with the savings of the long running workloads
+		if isBatch(rec.Kind) {
+			continue
+		}
+		totalCPUSave += rec.CPUSave
+		totalMemSave += rec.MemSave
+	}
 
 	totalMem := int64(totalMemSave)
-	totalMemStr := byteCountSI(totalMem)
+	resp := &Response{
+		Recommendations: recommendations,
+		Totals:          ReportSavings{CPU: totalCPUSave, Memory: totalMem},
+		Warnings:        qosWarnings(recommendations),
+		CPUSave:         totalCPUSave,
+		MemSave:         totalMem,
+	}
 	if totalMem < 0 {
-		totalMem *= -1
-		totalMemStr = byteCountSI(totalMem)
-		totalMemStr = fmt.Sprintf("-%s", totalMemStr)
+		resp.MemSave = -1 * totalMem
 	}
-	fmt.Printf("You could save %.2f vCPUs and %s Memory by changing the settings\n", totalCPUSave, totalMemStr)
-	return &Response{
-		Data:    data,
-		CPUSave: totalCPUSave,
-		MemSave: totalMem,
-	}, nil
+	return resp, nil
 }
 
-func currentValue(resources v1.ResourceRequirements, method string, resource v1.ResourceName, current int, format apresource.Format) (float64, string) {
-	curSaving := float64(current) * 1000 * 1000
-	if format == apresource.DecimalSI {
-		curSaving = float64(current) / 1000
+// setup connects to the cluster, finds the used namespaces and returns the source of usage.
+func (o *Options) setup(ctx context.Context) (MetricsSource, error) {
+	var err error
+	if o.Client == nil {
+		o.Client, err = newClientSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	o.usedNamespaces, err = buildUsedNamespaces(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Metrics != nil {
+		return o.Metrics, nil
+	}
+	return o.newMetricsSource(ctx, strings.Split(o.usedNamespaces, ","))
+}
+
+// newMetricsSource returns the source of usage. With the auto source metrics-server is used when
+// prometheus-operator is not detected from the cluster.
+func (o *Options) newMetricsSource(ctx context.Context, namespaces []string) (MetricsSource, error) {
+	switch o.Source {
+	case SourcePrometheus:
+		return o.newPrometheusSource(ctx)
+	case SourceMetricsServer:
+		return o.newMetricsServerSource(ctx, namespaces)
+	}
+
+	source, err := o.newPrometheusSource(ctx)
+	if err == nil {
+		return source, nil
+	}
+	if !errors.Is(err, errPrometheusNotDetected) || !o.metricsServerAvailable() {
+		return nil, err
 	}
+	fmt.Fprintf(os.Stderr, "%v, sampling metrics-server for %s\n", err, o.SampleDuration)
+	return o.newMetricsServerSource(ctx, namespaces)
+}
+
+// evaluationTime parses the evaluation time given as RFC 3339 or unix timestamp.
+func evaluationTime(at string) (time.Time, error) {
+	if at == "" {
+		return time.Now(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(at, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid evaluation time '%s', expected RFC 3339 or unix timestamp", at)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
 
-	if method == "limit" {
-		val, ok := resources.Limits[resource]
-		if ok {
-			return val.AsApproximateFloat64() - curSaving, val.String()
+// analyzeNamespace builds the recommendations for all workloads in the namespace.
+func (o *Options) analyzeNamespace(ctx context.Context, metrics MetricsSource, namespace string) ([]Recommendation, error) {
+	var err error
+	recommendations := []Recommendation{}
+	for _, handle := range []func(context.Context, string, MetricsSource, []Recommendation) ([]Recommendation, error){
+		o.handleDeployments,
+		o.handleStatefulsets,
+		o.handleDaemonsets,
+		o.handleCronJobs,
+		o.handleJobs,
+	} {
+		recommendations, err = handle(ctx, namespace, metrics, recommendations)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		val, ok := resources.Requests[resource]
-		if ok {
-			return val.AsApproximateFloat64() - curSaving, val.String()
+	}
+	return recommendations, nil
+}
+
+// cpuQuantity converts cores to a quantity in millicores.
+func cpuQuantity(cores float64) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(cores*1000), resource.DecimalSI)
+}
+
+// memoryQuantity converts mebibytes to a quantity in bytes.
+func memoryQuantity(mebibytes float64) resource.Quantity {
+	return *resource.NewQuantity(int64(mebibytes)*1024*1024, resource.BinarySI)
+}
+
+// saving returns how much the current value exceeds the recommended value. Unset current value is
+// counted as zero.
+func saving(current v1.ResourceList, recommended v1.ResourceList, name v1.ResourceName) float64 {
+	rec := recommended[name]
+	cur, ok := current[name]
+	if !ok {
+		return -1 * rec.AsApproximateFloat64()
+	}
+	return cur.AsApproximateFloat64() - rec.AsApproximateFloat64()
+}
+
+// containerType returns the type of an init container, native sidecars are init containers which
+// keep running for the lifetime of the pod.
+func containerType(container v1.Container) string {
+	if container.RestartPolicy != nil && *container.RestartPolicy == v1.ContainerRestartPolicyAlways {
+		return ContainerTypeSidecar
+	}
+	return ContainerTypeInit
+}
+
+// effectiveRequest returns the pod level request of the resource the way the scheduler sees it:
+// the larger of the sum of app containers and sidecars and the largest init container together
+// with the sidecars started before it. The index of the dominating init container is returned, or
+// -1 when the app containers and sidecars dominate.
+func effectiveRequest(recommendations []Recommendation, requests func(Recommendation) v1.ResourceList, name v1.ResourceName) (float64, int) {
+	sidecars := float64(0.00)
+	longRunning := float64(0.00)
+	highestInit := float64(0.00)
+	dominating := -1
+	for i, rec := range recommendations {
+		value := requests(rec)[name]
+		switch rec.ContainerType {
+		case ContainerTypeInit:
+			if v := value.AsApproximateFloat64() + sidecars; v > highestInit {
+				highestInit = v
+				dominating = i
+			}
+		case ContainerTypeSidecar:
+			sidecars += value.AsApproximateFloat64()
+			longRunning += value.AsApproximateFloat64()
+		default:
+			longRunning += value.AsApproximateFloat64()
 		}
 	}
-	return -1 * curSaving, "<nil>"
-}
-
-func (o *Options) analyzeDaemonSet(data [][]string, daemonset appsv1.DaemonSet, finalMetrics prometheusMetrics) ([][]string, float64, float64) {
-	totalCPUSavings := float64(0.00)
-	totalMemSavings := float64(0.00)
-	for _, container := range daemonset.Spec.Template.Spec.Containers {
-		reqCPU := int(finalMetrics.RequestCPU[container.Name] * 1000)
-		reqMem := int(finalMetrics.RequestMem[container.Name])
-		limCPU := int(finalMetrics.LimitCPU[container.Name] * 1000)
-		limMem := int(finalMetrics.LimitMem[container.Name])
-
-		reqCPUSave, strReqCPU := currentValue(container.Resources, "request", v1.ResourceCPU, reqCPU, apresource.DecimalSI)
-		reqMemSave, strReqMem := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
-		_, strLimCPU := currentValue(container.Resources, "limit", v1.ResourceCPU, limCPU, apresource.DecimalSI)
-		_, strLimMem := currentValue(container.Resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
-
-		totalCPUSavings += reqCPUSave * float64(daemonset.Status.DesiredNumberScheduled)
-		totalMemSavings += reqMemSave * float64(daemonset.Status.DesiredNumberScheduled)
-		data = append(data, []string{
-			daemonset.Namespace,
-			fmt.Sprintf("daemonset/%s", daemonset.Name),
-			container.Name,
-			fmt.Sprintf("%dm (%s)", reqCPU, strReqCPU),
-			fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
-			fmt.Sprintf("%dm (%s)", limCPU, strLimCPU),
-			fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
-		})
+	if highestInit > longRunning {
+		return highestInit, dominating
 	}
-	return data, totalCPUSavings, totalMemSavings
-}
-
-func (o *Options) analyzeStatefulset(data [][]string, statefulset appsv1.StatefulSet, finalMetrics prometheusMetrics) ([][]string, float64, float64) {
-	totalCPUSavings := float64(0.00)
-	totalMemSavings := float64(0.00)
-	for _, container := range statefulset.Spec.Template.Spec.Containers {
-		reqCPU := int(finalMetrics.RequestCPU[container.Name] * 1000)
-		reqMem := int(finalMetrics.RequestMem[container.Name])
-		limCPU := int(finalMetrics.LimitCPU[container.Name] * 1000)
-		limMem := int(finalMetrics.LimitMem[container.Name])
-
-		reqCPUSave, strReqCPU := currentValue(container.Resources, "request", v1.ResourceCPU, reqCPU, apresource.DecimalSI)
-		reqMemSave, strReqMem := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
-		_, strLimCPU := currentValue(container.Resources, "limit", v1.ResourceCPU, limCPU, apresource.DecimalSI)
-		_, strLimMem := currentValue(container.Resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
-
-		totalCPUSavings += reqCPUSave * float64(*statefulset.Spec.Replicas)
-		totalMemSavings += reqMemSave * float64(*statefulset.Spec.Replicas)
-		data = append(data, []string{
-			statefulset.Namespace,
-			fmt.Sprintf("statefulset/%s", statefulset.Name),
-			container.Name,
-			fmt.Sprintf("%dm (%s)", reqCPU, strReqCPU),
-			fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
-			fmt.Sprintf("%dm (%s)", limCPU, strLimCPU),
-			fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
-		})
+	return longRunning, -1
+}
+
+// podSaving calculates the savings of the pod following the effective request. App containers and
+// sidecars are attributed their own savings, the rest is attributed to the init container which
+// dominates the request.
+func podSaving(recommendations []Recommendation, name v1.ResourceName, replicas int32, set func(*Recommendation, float64)) {
+	current := func(rec Recommendation) v1.ResourceList { return rec.Current.Requests }
+	recommended := func(rec Recommendation) v1.ResourceList { return rec.Recommended.Requests }
+	currentTotal, currentInit := effectiveRequest(recommendations, current, name)
+	recommendedTotal, recommendedInit := effectiveRequest(recommendations, recommended, name)
+
+	attributed := float64(0.00)
+	for i := range recommendations {
+		value := float64(0.00)
+		if recommendations[i].ContainerType != ContainerTypeInit {
+			value = saving(recommendations[i].Current.Requests, recommendations[i].Recommended.Requests, name)
+		}
+		attributed += value
+		set(&recommendations[i], value*float64(replicas))
 	}
-	return data, totalCPUSavings, totalMemSavings
-}
-
-func (o *Options) analyzeDeployment(data [][]string, deployment appsv1.Deployment, finalMetrics prometheusMetrics) ([][]string, float64, float64) {
-	totalCPUSavings := float64(0.00)
-	totalMemSavings := float64(0.00)
-	for _, container := range deployment.Spec.Template.Spec.Containers {
-		reqCPU := int(finalMetrics.RequestCPU[container.Name] * 1000)
-		reqMem := int(finalMetrics.RequestMem[container.Name])
-		limCPU := int(finalMetrics.LimitCPU[container.Name] * 1000)
-		limMem := int(finalMetrics.LimitMem[container.Name])
-
-		reqCPUSave, strReqCPU := currentValue(container.Resources, "request", v1.ResourceCPU, reqCPU, apresource.DecimalSI)
-		reqMemSave, strReqMem := currentValue(container.Resources, "request", v1.ResourceMemory, reqMem, apresource.BinarySI)
-		_, strLimCPU := currentValue(container.Resources, "limit", v1.ResourceCPU, limCPU, apresource.DecimalSI)
-		_, strLimMem := currentValue(container.Resources, "limit", v1.ResourceMemory, limMem, apresource.BinarySI)
-
-		totalCPUSavings += reqCPUSave * float64(*deployment.Spec.Replicas)
-		totalMemSavings += reqMemSave * float64(*deployment.Spec.Replicas)
-		data = append(data, []string{
-			deployment.Namespace,
-			fmt.Sprintf("deployment/%s", deployment.Name),
-			container.Name,
-			fmt.Sprintf("%dm (%s)", reqCPU, strReqCPU),
-			fmt.Sprintf("%dMi (%s)", reqMem, strReqMem),
-			fmt.Sprintf("%dm (%s)", limCPU, strLimCPU),
-			fmt.Sprintf("%dMi (%s)", limMem, strLimMem),
-		})
+
+	dominating := currentInit
+	if dominating < 0 {
+		dominating = recommendedInit
 	}
-	return data, totalCPUSavings, totalMemSavings
+	if dominating >= 0 {
+		rest := (currentTotal - recommendedTotal) - attributed
+		set(&recommendations[dominating], rest*float64(replicas))
+	}
+}
+
+func (o *Options) analyzeContainers(recommendations []Recommendation, meta metav1.ObjectMeta, kind string, replicas int32, spec v1.PodSpec, resources map[string]ContainerResources) []Recommendation {
+	newRecommendation := func(container v1.Container, containerType string, index int) Recommendation {
+		return Recommendation{
+			Namespace:     meta.Namespace,
+			Kind:          kind,
+			Name:          meta.Name,
+			Container:     container.Name,
+			ContainerType: containerType,
+			Replicas:      replicas,
+			Current:       *container.Resources.DeepCopy(),
+			Recommended: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    cpuQuantity(resources[container.Name].RequestCPU),
+					v1.ResourceMemory: memoryQuantity(resources[container.Name].RequestMem),
+				},
+				Limits: o.limits(meta.Namespace, container, resources[container.Name]),
+			},
+			Risk:  resources[container.Name].Risk,
+			index: index,
+		}
+	}
+
+	pod := make([]Recommendation, 0, len(spec.InitContainers)+len(spec.Containers))
+	for i, container := range spec.InitContainers {
+		pod = append(pod, newRecommendation(container, containerType(container), i))
+	}
+	for i, container := range spec.Containers {
+		pod = append(pod, newRecommendation(container, ContainerTypeApp, i))
+	}
+
+	podSaving(pod, v1.ResourceCPU, replicas, func(rec *Recommendation, value float64) { rec.CPUSave = value })
+	podSaving(pod, v1.ResourceMemory, replicas, func(rec *Recommendation, value float64) { rec.MemSave = value })
+	return append(recommendations, pod...)
+}
+
+func (o *Options) analyzeDaemonSet(recommendations []Recommendation, daemonset appsv1.DaemonSet, resources map[string]ContainerResources) []Recommendation {
+	return o.analyzeContainers(recommendations, daemonset.ObjectMeta, KindDaemonSet, daemonset.Status.DesiredNumberScheduled, daemonset.Spec.Template.Spec, resources)
+}
+
+func (o *Options) analyzeStatefulset(recommendations []Recommendation, statefulset appsv1.StatefulSet, resources map[string]ContainerResources) []Recommendation {
+	return o.analyzeContainers(recommendations, statefulset.ObjectMeta, KindStatefulSet, *statefulset.Spec.Replicas, statefulset.Spec.Template.Spec, resources)
+}
+
+func (o *Options) analyzeDeployment(recommendations []Recommendation, deployment appsv1.Deployment, resources map[string]ContainerResources) []Recommendation {
+	return o.analyzeContainers(recommendations, deployment.ObjectMeta, KindDeployment, *deployment.Spec.Replicas, deployment.Spec.Template.Spec, resources)
+}
+
+// isBatch returns true for the kinds whose pods run to completion.
+func isBatch(kind string) bool {
+	return kind == KindJob || kind == KindCronJob
+}
+
+// jobReplicas returns the number of pods the job runs in parallel.
+func jobReplicas(spec batchv1.JobSpec) int32 {
+	if spec.Parallelism == nil {
+		return 1
+	}
+	return *spec.Parallelism
+}
+
+func (o *Options) analyzeCronJob(recommendations []Recommendation, cronJob batchv1.CronJob, resources map[string]ContainerResources) []Recommendation {
+	return o.analyzeContainers(recommendations, cronJob.ObjectMeta, KindCronJob, jobReplicas(cronJob.Spec.JobTemplate.Spec), cronJob.Spec.JobTemplate.Spec.Template.Spec, resources)
+}
+
+func (o *Options) analyzeJob(recommendations []Recommendation, job batchv1.Job, resources map[string]ContainerResources) []Recommendation {
+	return o.analyzeContainers(recommendations, job.ObjectMeta, KindJob, jobReplicas(job.Spec), job.Spec.Template.Spec, resources)
 }
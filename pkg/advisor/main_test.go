@@ -0,0 +1,252 @@
+package advisor
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+// fakeSource returns fixed usage of every workload.
+type fakeSource map[Workload]Usage
+
+func (f fakeSource) WorkloadUsage(_ context.Context, workload Workload) (Usage, error) {
+	return f[workload], nil
+}
+
+var web = Workload{Namespace: "ns", Kind: KindDeployment, Name: "web"}
+
+func resourceList(cpu string, memory string) v1.ResourceList {
+	list := v1.ResourceList{}
+	if cpu != "" {
+		list[v1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[v1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return list
+}
+
+// webDeployment returns deployment web with an init container, a native sidecar and an app container.
+func webDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](2),
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				InitContainers: []v1.Container{
+					{Name: "migrate", Resources: v1.ResourceRequirements{Requests: resourceList("1", "512Mi")}},
+					{Name: "proxy", RestartPolicy: ptr.To(v1.ContainerRestartPolicyAlways), Resources: v1.ResourceRequirements{Requests: resourceList("100m", "64Mi")}},
+				},
+				Containers: []v1.Container{
+					{Name: "app", Resources: v1.ResourceRequirements{
+						Requests: resourceList("500m", "1Gi"),
+						Limits:   resourceList("1", "2Gi"),
+					}},
+				},
+			}},
+		},
+	}
+}
+
+// webUsage returns usage of deployment web whose requests and limits with the default limit margin
+// fit within the rounding steps.
+func webUsage() Usage {
+	return Usage{
+		RequestCPU: map[string]float64{"migrate": 0.3, "proxy": 0.05, "app": 0.2},
+		RequestMem: map[string]float64{"migrate": 200, "proxy": 50, "app": 300},
+		LimitCPU:   map[string]float64{"migrate": 0.2, "proxy": 0.08, "app": 0.3},
+		LimitMem:   map[string]float64{"migrate": 150, "proxy": 80, "app": 450},
+	}
+}
+
+// analyzeFake analyzes namespace ns of a fake cluster with the usage of the fake source.
+func analyzeFake(t *testing.T, o *Options, usage fakeSource, objects ...runtime.Object) *Response {
+	t.Helper()
+	o.Client = fake.NewClientset(objects...)
+	o.Metrics = usage
+	o.Namespaces = "ns"
+	o.Out = io.Discard
+	o.loadDefaults()
+	resp, err := o.analyze(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func recommendationOf(t *testing.T, resp *Response, container string) Recommendation {
+	t.Helper()
+	for _, rec := range resp.Recommendations {
+		if rec.Container == container {
+			return rec
+		}
+	}
+	t.Fatalf("no recommendation for container %s in %v", container, resp.Recommendations)
+	return Recommendation{}
+}
+
+func assertQuantity(t *testing.T, name string, list v1.ResourceList, resourceName v1.ResourceName, expected string) {
+	t.Helper()
+	actual, ok := list[resourceName]
+	if expected == "" {
+		if ok {
+			t.Errorf("%s: expected no %s, got %s", name, resourceName, actual.String())
+		}
+		return
+	}
+	if !ok || actual.Cmp(resource.MustParse(expected)) != 0 {
+		t.Errorf("%s: expected %s %s, got %s", name, resourceName, expected, actual.String())
+	}
+}
+
+func TestEffectiveRequest(t *testing.T) {
+	container := func(containerType string, cpu string) Recommendation {
+		return Recommendation{ContainerType: containerType, Current: v1.ResourceRequirements{Requests: resourceList(cpu, "")}}
+	}
+	for _, tc := range []struct {
+		name       string
+		containers []Recommendation
+		expected   float64
+		dominating int
+	}{
+		{"app containers", []Recommendation{container(ContainerTypeApp, "100m"), container(ContainerTypeApp, "200m")}, 0.3, -1},
+		{"init container below app containers", []Recommendation{container(ContainerTypeInit, "200m"), container(ContainerTypeApp, "300m")}, 0.3, -1},
+		{"largest init container", []Recommendation{container(ContainerTypeInit, "1"), container(ContainerTypeInit, "2"), container(ContainerTypeApp, "300m")}, 2, 1},
+		// sidecars started before an init container run next to it
+		{"sidecar before init container", []Recommendation{container(ContainerTypeSidecar, "500m"), container(ContainerTypeInit, "1"), container(ContainerTypeApp, "100m")}, 1.5, 1},
+		{"sidecar after init container", []Recommendation{container(ContainerTypeInit, "1"), container(ContainerTypeSidecar, "500m"), container(ContainerTypeApp, "100m")}, 1, 0},
+		{"sidecars and app containers", []Recommendation{container(ContainerTypeSidecar, "500m"), container(ContainerTypeInit, "200m"), container(ContainerTypeApp, "1")}, 1.5, -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, dominating := effectiveRequest(tc.containers, func(rec Recommendation) v1.ResourceList { return rec.Current.Requests }, v1.ResourceCPU)
+			if math.Abs(actual-tc.expected) > 1e-9 || dominating != tc.dominating {
+				t.Errorf("expected %g dominated by %d, got %g dominated by %d", tc.expected, tc.dominating, actual, dominating)
+			}
+		})
+	}
+}
+
+func TestAnalyzePodSaving(t *testing.T) {
+	resp := analyzeFake(t, &Options{}, fakeSource{web: webUsage()}, webDeployment())
+
+	for _, tc := range []struct {
+		container     string
+		containerType string
+		index         int
+		cpuSave       float64
+		memSave       float64
+	}{
+		// the init container dominates the current cpu request of the pod, so it gets the saving
+		// beyond the savings of the long running containers
+		{"migrate", ContainerTypeInit, 0, 0.8, 0},
+		{"proxy", ContainerTypeSidecar, 1, 0, -2 * 36 * 1024 * 1024},
+		{"app", ContainerTypeApp, 0, 0.6, 2 * 724 * 1024 * 1024},
+	} {
+		t.Run(tc.container, func(t *testing.T) {
+			rec := recommendationOf(t, resp, tc.container)
+			if rec.ContainerType != tc.containerType || rec.index != tc.index || rec.Replicas != 2 {
+				t.Errorf("expected %s container at index %d with 2 replicas, got %s at %d with %d", tc.containerType, tc.index, rec.ContainerType, rec.index, rec.Replicas)
+			}
+			if math.Abs(rec.CPUSave-tc.cpuSave) > 1e-9 {
+				t.Errorf("expected cpu saving %g, got %g", tc.cpuSave, rec.CPUSave)
+			}
+			if math.Abs(rec.MemSave-tc.memSave) > 1 {
+				t.Errorf("expected memory saving %g, got %g", tc.memSave, rec.MemSave)
+			}
+		})
+	}
+
+	// the totals are the change of the effective pod requests: cpu from 1 core of the init container
+	// to 0.3 cores, memory from 1088Mi of the long running containers to 400Mi
+	if math.Abs(resp.Totals.CPU-2*0.7) > 1e-9 {
+		t.Errorf("expected total cpu saving 1.4, got %g", resp.Totals.CPU)
+	}
+	if expected := int64(2 * 688 * 1024 * 1024); resp.Totals.Memory != expected {
+		t.Errorf("expected total memory saving %d, got %d", expected, resp.Totals.Memory)
+	}
+}
+
+func TestAnalyzeBatchWorkloads(t *testing.T) {
+	template := v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{
+		{Name: "worker", Resources: v1.ResourceRequirements{Requests: resourceList("1", "1Gi")}},
+	}}}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nightly"},
+		Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+			Parallelism: ptr.To[int32](3),
+			Template:    template,
+		}}},
+	}
+	ownedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nightly-29000000", OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "batch/v1", Kind: "CronJob", Name: "nightly"},
+		}},
+		Spec: batchv1.JobSpec{Template: template},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "backfill"},
+		Spec:       batchv1.JobSpec{Template: template},
+	}
+	batchUsage := Usage{
+		RequestCPU: map[string]float64{"worker": 0.1},
+		RequestMem: map[string]float64{"worker": 100},
+		LimitCPU:   map[string]float64{"worker": 0.5},
+		LimitMem:   map[string]float64{"worker": 300},
+		PeakCPU:    map[string]float64{"worker": 0.4},
+		PeakMem:    map[string]float64{"worker": 200},
+	}
+	usage := fakeSource{
+		web: webUsage(),
+		{Namespace: "ns", Kind: KindCronJob, Name: "nightly"}: batchUsage,
+		{Namespace: "ns", Kind: KindJob, Name: "backfill"}:    batchUsage,
+	}
+	resp := analyzeFake(t, &Options{}, usage, webDeployment(), cronJob, ownedJob, job)
+
+	batch := map[string]Recommendation{}
+	for _, rec := range resp.Recommendations {
+		if isBatch(rec.Kind) {
+			batch[rec.Kind+"/"+rec.Name] = rec
+		}
+	}
+	for _, tc := range []struct {
+		workload string
+		replicas int32
+	}{
+		{"cronjob/nightly", 3},
+		{"job/backfill", 1},
+	} {
+		t.Run(tc.workload, func(t *testing.T) {
+			rec, ok := batch[tc.workload]
+			if !ok {
+				t.Fatalf("no recommendation for %s in %v", tc.workload, resp.Recommendations)
+			}
+			if rec.Replicas != tc.replicas {
+				t.Errorf("expected %d replicas, got %d", tc.replicas, rec.Replicas)
+			}
+			// batch workloads request their peak usage
+			assertQuantity(t, "requests", rec.Recommended.Requests, v1.ResourceCPU, "400m")
+			assertQuantity(t, "requests", rec.Recommended.Requests, v1.ResourceMemory, "200Mi")
+		})
+	}
+	if len(batch) != 2 {
+		t.Errorf("expected jobs of cronjobs to be analyzed as part of the cronjob, got %v", batch)
+	}
+
+	// the totals contain only the savings of deployment web
+	if math.Abs(resp.Totals.CPU-2*0.7) > 1e-9 {
+		t.Errorf("expected total cpu saving 1.4, got %g", resp.Totals.CPU)
+	}
+	if expected := int64(2 * 688 * 1024 * 1024); resp.Totals.Memory != expected {
+		t.Errorf("expected total memory saving %d, got %d", expected, resp.Totals.Memory)
+	}
+}
@@ -0,0 +1,87 @@
+package advisor
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// MetricsSource provides usage statistics of containers. Prometheus is used when Options.Metrics
+// is not set. Implementations must be safe for concurrent use as namespaces are analyzed in
+// parallel.
+type MetricsSource interface {
+	// WorkloadUsage returns the usage of every container of the workload over the lookback window.
+	// Containers without usage are left out.
+	WorkloadUsage(ctx context.Context, workload Workload) (Usage, error)
+}
+
+// Workload identifies a single workload.
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"` // one of the Kind constants
+	Name      string `json:"name"`
+}
+
+// Usage contains the usage statistics of the containers of a workload by container name. CPU is in
+// cores and memory in mebibytes. When the workload had several pods, the highest value of them is
+// used.
+type Usage struct {
+	LimitCPU   map[string]float64 `json:"limitCPU"`   // usage the limit is based on, the peak usage unless the limit is queried with a template
+	LimitMem   map[string]float64 `json:"limitMem"`   // usage the limit is based on, the peak usage unless the limit is queried with a template
+	RequestCPU map[string]float64 `json:"requestCPU"` // usage at the quantile
+	RequestMem map[string]float64 `json:"requestMem"` // usage at the quantile
+	PeakCPU    map[string]float64 `json:"peakCPU"`
+	PeakMem    map[string]float64 `json:"peakMem"`
+	Throttled  map[string]float64 `json:"throttled,omitempty"` // fraction of cpu periods throttled
+	OOMKilled  map[string]float64 `json:"oomKilled,omitempty"` // 1 when a pod was OOM killed and restarted during the window
+	Restarts   map[string]float64 `json:"restarts,omitempty"`  // restarts of a pod during the window
+	Samples    *Samples           `json:"-"`                   // set only for strategies which use samples
+}
+
+// SampleSource is implemented by metrics sources which provide the usage samples over the lookback
+// window. The histogram strategy requires it.
+type SampleSource interface {
+	// WorkloadSamples returns the usage samples of every container of the workload.
+	WorkloadSamples(ctx context.Context, workload Workload) (Samples, error)
+}
+
+// Samples contains the usage samples of the containers of a workload by container name. The samples
+// of every pod of the workload are combined. CPU is in cores and memory in mebibytes.
+type Samples struct {
+	CPU    map[string][]Sample `json:"cpu"`
+	Memory map[string][]Sample `json:"memory"`
+}
+
+// Sample is the usage of a container at a point in time.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// containers returns the names of the containers which have any usage.
+func (u Usage) containers() []string {
+	seen := map[string]bool{}
+	containers := []string{}
+	for _, values := range []map[string]float64{u.LimitCPU, u.LimitMem, u.RequestCPU, u.RequestMem, u.PeakCPU, u.PeakMem} {
+		for container := range values {
+			if !seen[container] {
+				seen[container] = true
+				containers = append(containers, container)
+			}
+		}
+	}
+	return containers
+}
+
+// sortSamples orders the samples of every container by time such that the results do not depend on
+// the order the pods were collected in.
+func sortSamples(samples map[string][]Sample) {
+	for _, values := range samples {
+		sort.SliceStable(values, func(i, j int) bool {
+			if !values[i].Time.Equal(values[j].Time) {
+				return values[i].Time.Before(values[j].Time)
+			}
+			return values[i].Value < values[j].Value
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	metricsServerGroupVersion = "metrics.k8s.io/v1beta1"
+	podMetricsPath            = "/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods"
+	metricsServerInterval     = 15 * time.Second
+)
+
+// podMetricsList is the PodMetricsList of the metrics.k8s.io API. Only the fields used by the
+// advisor are included.
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Timestamp  metav1.Time       `json:"timestamp"`
+		Containers []struct {
+			Name  string          `json:"name"`
+			Usage v1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// metricsServerSource is the MetricsSource backed by metrics-server. The usage of every pod is
+// sampled for the sample duration before the analysis starts, so it covers only a short window.
+type metricsServerSource struct {
+	*sampledSource
+}
+
+// metricsServerAvailable reports whether the metrics.k8s.io API is served by the cluster.
+func (o *Options) metricsServerAvailable() bool {
+	_, err := o.Client.Discovery().ServerResourcesForGroupVersion(metricsServerGroupVersion)
+	return err == nil
+}
+
+// newMetricsServerSource samples the usage of the pods in the namespaces for the sample duration.
+func (o *Options) newMetricsServerSource(ctx context.Context, namespaces []string) (*metricsServerSource, error) {
+	if !o.metricsServerAvailable() {
+		return nil, fmt.Errorf("metrics-server not detected, %s is not available", metricsServerGroupVersion)
+	}
+	// metrics-server has only the current usage which is sampled from now on
+	if o.At != "" {
+		return nil, fmt.Errorf("--at can not be used with metrics-server, the usage is sampled from now on")
+	}
+	if !o.defaultWindow {
+		return nil, fmt.Errorf("--window can not be used with metrics-server, the usage covers --sample-duration")
+	}
+	o.mode = ModeMetricsServer
+	o.history = HistoryPods
+
+	source := &metricsServerSource{newSampledSource(o)}
+	if err := source.sample(ctx, namespaces); err != nil {
+		return nil, err
+	}
+	// the usage covers the sample duration before now, not before the start of the run
+	o.at = time.Now()
+	for _, namespace := range namespaces {
+		owners, err := o.listOwners(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		source.workloads[namespace] = owners.resolve(namespace)
+	}
+	return source, nil
+}
+
+// sample polls the pod metrics of the namespaces until the sample duration has passed. A sample
+// is recorded only when metrics-server has updated the metrics of the pod.
+func (m *metricsServerSource) sample(ctx context.Context, namespaces []string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.o.SampleDuration)
+	defer cancel()
+	ticker := time.NewTicker(metricsServerInterval)
+	defer ticker.Stop()
+
+	updated := map[string]time.Time{}
+	for {
+		for _, namespace := range namespaces {
+			list, err := m.podMetrics(ctx, namespace)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			for _, pod := range list.Items {
+				name := namespace + "/" + pod.Metadata.Name
+				if !pod.Timestamp.After(updated[name]) {
+					continue
+				}
+				updated[name] = pod.Timestamp.Time
+				for _, container := range pod.Containers {
+					key := containerKey{Namespace: namespace, Pod: pod.Metadata.Name, Container: container.Name}
+					if m.samples[key] == nil {
+						m.samples[key] = &containerSamples{}
+					}
+					m.samples[key].CPU = append(m.samples[key].CPU, Sample{Time: pod.Timestamp.Time, Value: container.Usage.Cpu().AsApproximateFloat64()})
+					m.samples[key].Memory = append(m.samples[key].Memory, Sample{Time: pod.Timestamp.Time, Value: container.Usage.Memory().AsApproximateFloat64() / 1024 / 1024})
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *metricsServerSource) podMetrics(ctx context.Context, namespace string) (*podMetricsList, error) {
+	client := m.o.Client.Discovery().RESTClient()
+	if client == nil {
+		return nil, fmt.Errorf("metrics-server can not be queried with this client")
+	}
+	raw, err := client.Get().AbsPath(fmt.Sprintf(podMetricsPath, namespace)).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error querying metrics-server %w", err)
+	}
+	list := &podMetricsList{}
+	if err := json.Unmarshal(raw, list); err != nil {
+		return nil, fmt.Errorf("failed to parse pod metrics: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,110 @@
+package advisor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// metricsServerAPI serves the pod metrics and the owners of a single pod of deployment web.
+func metricsServerAPI(t *testing.T, timestamp time.Time) *httptest.Server {
+	t.Helper()
+	responses := map[string]string{
+		"/apis/metrics.k8s.io/v1beta1": `{"kind":"APIResourceList","groupVersion":"metrics.k8s.io/v1beta1","resources":[{"name":"pods","namespaced":true,"kind":"PodMetrics","verbs":["get","list"]}]}`,
+		"/apis/metrics.k8s.io/v1beta1/namespaces/ns/pods": `{"items":[{"metadata":{"name":"web-abc-1","namespace":"ns"},"timestamp":"` + timestamp.Format(time.RFC3339) + `",` +
+			`"containers":[{"name":"app","usage":{"cpu":"250m","memory":"256Mi"}},{"name":"sidecar","usage":{"cpu":"10m","memory":"32Mi"}}]}]}`,
+		"/api/v1/namespaces/ns/pods": `{"kind":"PodList","apiVersion":"v1","items":[{"metadata":{"name":"web-abc-1","namespace":"ns",` +
+			`"ownerReferences":[{"apiVersion":"apps/v1","kind":"ReplicaSet","name":"web-abc","uid":"1","controller":true}]}}]}`,
+		"/apis/apps/v1/namespaces/ns/replicasets": `{"kind":"ReplicaSetList","apiVersion":"apps/v1","items":[{"metadata":{"name":"web-abc","namespace":"ns",` +
+			`"ownerReferences":[{"apiVersion":"apps/v1","kind":"Deployment","name":"web","uid":"2","controller":true}]}}]}`,
+		"/apis/batch/v1/namespaces/ns/jobs": `{"kind":"JobList","apiVersion":"batch/v1","items":[]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMetricsServerSamples(t *testing.T) {
+	timestamp := time.Now().Add(-time.Minute).Truncate(time.Second)
+	server := metricsServerAPI(t, timestamp)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &Options{Client: client, SampleDuration: 100 * time.Millisecond}
+	o.loadDefaults()
+	source, err := o.newMetricsServerSource(context.Background(), []string{"ns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.at.Before(timestamp) {
+		t.Errorf("evaluation time %s is before the samples at %s", o.at, timestamp)
+	}
+
+	samples, err := source.WorkloadSamples(context.Background(), Workload{Namespace: "ns", Kind: KindDeployment, Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		samples   map[string][]Sample
+		container string
+		expected  float64
+	}{
+		{"cpu of app", samples.CPU, "app", 0.25},
+		{"cpu of sidecar", samples.CPU, "sidecar", 0.01},
+		{"memory of app", samples.Memory, "app", 256},
+		{"memory of sidecar", samples.Memory, "sidecar", 32},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			values := tc.samples[tc.container]
+			if len(values) != 1 {
+				t.Fatalf("expected 1 sample, got %v", values)
+			}
+			if !values[0].Time.Equal(timestamp) || values[0].Value != tc.expected {
+				t.Errorf("expected %g at %s, got %v", tc.expected, timestamp, values[0])
+			}
+		})
+	}
+}
+
+func TestMetricsServerEvaluationRange(t *testing.T) {
+	server := metricsServerAPI(t, time.Now())
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		options Options
+		err     string
+	}{
+		{"at", Options{At: "2026-01-02T03:04:05Z"}, "--at can not be used with metrics-server"},
+		{"window", Options{Window: "2w"}, "--window can not be used with metrics-server"},
+		{"window set to the default", Options{Window: "1w"}, "--window can not be used with metrics-server"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &tc.options
+			o.Client, o.SampleDuration = client, 100*time.Millisecond
+			o.loadDefaults()
+			_, err := o.newMetricsServerSource(context.Background(), []string{"ns"})
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
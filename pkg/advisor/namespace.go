@@ -0,0 +1,429 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// prometheusSource is the MetricsSource backed by Prometheus. The usage of a namespace is fetched
+// when a workload of the namespace is requested for the first time.
+type prometheusSource struct {
+	o          *Options
+	mu         sync.Mutex
+	namespaces map[string]*namespaceFetch
+}
+
+// namespaceFetch fetches the metrics and the samples of a single namespace only once.
+type namespaceFetch struct {
+	once        sync.Once
+	metrics     *namespaceMetrics
+	err         error
+	samplesOnce sync.Once
+	samples     *namespaceSamples
+	samplesErr  error
+}
+
+// newPrometheusSource connects to Prometheus and detects the available metrics.
+func (o *Options) newPrometheusSource(ctx context.Context) (*prometheusSource, error) {
+	var err error
+	o.promClient, err = makeClientForCluster(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkQueryTemplates(ctx, strings.Split(o.usedNamespaces, ",")[0]); err != nil {
+		return nil, err
+	}
+
+	o.mode, err = o.detectMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.history, err = o.detectHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &prometheusSource{o: o, namespaces: map[string]*namespaceFetch{}}, nil
+}
+
+// fetch returns the metrics of the namespace, fetching them on the first call.
+func (p *prometheusSource) fetch(ctx context.Context, namespace string) (*namespaceFetch, error) {
+	p.mu.Lock()
+	fetch, ok := p.namespaces[namespace]
+	if !ok {
+		fetch = &namespaceFetch{}
+		p.namespaces[namespace] = fetch
+	}
+	p.mu.Unlock()
+
+	fetch.once.Do(func() {
+		fetch.metrics, fetch.err = p.o.fetchNamespace(ctx, namespace)
+	})
+	return fetch, fetch.err
+}
+
+func (p *prometheusSource) WorkloadUsage(ctx context.Context, workload Workload) (Usage, error) {
+	fetch, err := p.fetch(ctx, workload.Namespace)
+	if err != nil {
+		return Usage{}, err
+	}
+	return fetch.metrics.workload(workload), nil
+}
+
+func (p *prometheusSource) WorkloadSamples(ctx context.Context, workload Workload) (Samples, error) {
+	if p.o.mode == ModeCustom {
+		return Samples{}, fmt.Errorf("usage samples are not available with custom cpu queries")
+	}
+	fetch, err := p.fetch(ctx, workload.Namespace)
+	if err != nil {
+		return Samples{}, err
+	}
+	fetch.samplesOnce.Do(func() {
+		fetch.samples, fetch.samplesErr = p.o.querySamples(ctx, workload.Namespace)
+	})
+	if fetch.samplesErr != nil {
+		return Samples{}, fetch.samplesErr
+	}
+	return fetch.samples.workload(fetch.metrics.workloads, workload), nil
+}
+
+// namespaceMetrics contains the usage of every container in a namespace and the workload each pod
+// belongs to. Everything is fetched with a fixed number of queries per namespace and the results
+// are mapped to workloads afterwards.
+type namespaceMetrics struct {
+	series    seriesMetrics
+	workloads map[string]Workload // pod name to workload
+}
+
+// ownerRef is the direct owner of a pod, or the owner of a replicaset or a job.
+type ownerRef struct {
+	Kind string
+	Name string
+}
+
+// ownership contains the owners found from kube-state-metrics or from the Kubernetes API.
+type ownership struct {
+	pods        map[string]ownerRef
+	replicaSets map[string]ownerRef
+	jobs        map[string]ownerRef
+}
+
+func newOwnership() ownership {
+	return ownership{
+		pods:        map[string]ownerRef{},
+		replicaSets: map[string]ownerRef{},
+		jobs:        map[string]ownerRef{},
+	}
+}
+
+// resolve maps every pod to the workload that manages it. Pods of replicasets are mapped to the
+// deployment and pods of jobs to the cronjob when there is one. Pods of workloads which are not
+// analyzed, such as bare replicasets, are left out.
+func (w ownership) resolve(namespace string) map[string]Workload {
+	workloads := map[string]Workload{}
+	for pod, owner := range w.pods {
+		ref := Workload{Namespace: namespace, Name: owner.Name}
+		switch owner.Kind {
+		case "ReplicaSet":
+			deployment, ok := w.replicaSets[owner.Name]
+			if !ok || deployment.Kind != "Deployment" {
+				continue
+			}
+			ref.Kind = KindDeployment
+			ref.Name = deployment.Name
+		case "Job":
+			ref.Kind = KindJob
+			if cronJob, ok := w.jobs[owner.Name]; ok && cronJob.Kind == "CronJob" {
+				ref.Kind = KindCronJob
+				ref.Name = cronJob.Name
+			}
+		case "StatefulSet":
+			ref.Kind = KindStatefulSet
+		case "DaemonSet":
+			ref.Kind = KindDaemonSet
+		default:
+			continue
+		}
+		workloads[pod] = ref
+	}
+	return workloads
+}
+
+// fetchNamespace queries the usage of every container in the namespace and finds the workload of
+// each pod. Like namespaces, up to the concurrency queries of the namespace run at the same time.
+func (o *Options) fetchNamespace(ctx context.Context, namespace string) (*namespaceMetrics, error) {
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(o.Concurrency)
+	series := o.queryNamespace(groupCtx, group, namespace)
+
+	owners := newOwnership()
+	if o.history == HistoryOwners {
+		o.queryOwners(groupCtx, group, namespace, owners)
+	} else {
+		group.Go(func() error {
+			var err error
+			owners, err = o.listOwners(groupCtx, namespace)
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	// without limit templates the limits are based on the peak usage
+	if series.LimitCPU == nil {
+		series.LimitCPU = series.PeakCPU
+	}
+	if series.LimitMem == nil {
+		series.LimitMem = series.PeakMem
+	}
+
+	return &namespaceMetrics{
+		series:    *series,
+		workloads: owners.resolve(namespace),
+	}, nil
+}
+
+// queryNamespace starts the queries of usage statistics of every container in the namespace in the
+// group. The statistics are set when the group has finished.
+func (o *Options) queryNamespace(ctx context.Context, group *errgroup.Group, namespace string) *seriesMetrics {
+	queries := o.namespaceQueries(namespace)
+	output := &seriesMetrics{}
+	for _, query := range []struct {
+		target *map[containerKey]float64
+		query  string
+	}{
+		{&output.RequestCPU, queries.RequestCPU},
+		{&output.LimitCPU, queries.LimitCPU},
+		{&output.RequestMem, queries.RequestMem},
+		{&output.LimitMem, queries.LimitMem},
+		{&output.PeakCPU, queries.PeakCPU},
+		{&output.PeakMem, queries.PeakMem},
+		{&output.Throttled, queries.Throttled},
+		{&output.OOMKilled, queries.OOMKilled},
+		{&output.Restarts, queries.Restarts},
+	} {
+		if query.query == "" {
+			continue
+		}
+		group.Go(func() error {
+			result, err := queryStatistic(ctx, o.promClient, fmt.Sprintf(groupByContainer, query.query), o.at)
+			if err != nil {
+				return err
+			}
+			*query.target = result
+			return nil
+		})
+	}
+	return output
+}
+
+// namespaceSamples contains the usage samples of every container in a namespace.
+type namespaceSamples struct {
+	cpu    map[containerKey][]Sample
+	memory map[containerKey][]Sample
+}
+
+// querySamples queries the usage samples of every container in the namespace over the lookback
+// window.
+func (o *Options) querySamples(ctx context.Context, namespace string) (*namespaceSamples, error) {
+	selector := o.selector(fmt.Sprintf(`namespace="%s"`, namespace), `container!=""`)
+	cpu := fmt.Sprintf(ruleCPUUsage, o.mode, selector)
+	if o.mode == ModeRaw {
+		cpu = fmt.Sprintf(rawCPUUsage5m, selector)
+	}
+
+	window, err := prommodel.ParseDuration(o.Window)
+	if err != nil {
+		return nil, err
+	}
+	// Prometheus rejects ranges of more than 11000 samples per series
+	step := max(sampleStep, (time.Duration(window)/maxRangeSamples).Truncate(time.Minute)+time.Minute)
+	r := promv1.Range{Start: o.at.Add(-time.Duration(window)), End: o.at, Step: step}
+
+	samples := &namespaceSamples{}
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(o.Concurrency)
+	for _, query := range []struct {
+		target *map[containerKey][]Sample
+		query  string
+	}{
+		{&samples.cpu, cpu},
+		{&samples.memory, fmt.Sprintf(podMemoryUsage, selector)},
+	} {
+		group.Go(func() error {
+			var err error
+			*query.target, err = queryRange(groupCtx, o.promClient, fmt.Sprintf(groupByContainer, query.query), r)
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// workload returns the samples of the containers of the workload.
+func (n *namespaceSamples) workload(workloads map[string]Workload, workload Workload) Samples {
+	samples := Samples{CPU: map[string][]Sample{}, Memory: map[string][]Sample{}}
+	for k, v := range n.cpu {
+		if workloads[k.Pod] == workload {
+			samples.CPU[k.Container] = append(samples.CPU[k.Container], v...)
+		}
+	}
+	for k, v := range n.memory {
+		if workloads[k.Pod] == workload {
+			samples.Memory[k.Container] = append(samples.Memory[k.Container], v...)
+		}
+	}
+	sortSamples(samples.CPU)
+	sortSamples(samples.Memory)
+	return samples
+}
+
+// queryOwners starts the queries of the owners of every pod the namespace had during the lookback
+// window from kube-state-metrics in the group, including pods which no longer exist. The owners
+// are set when the group has finished.
+func (o *Options) queryOwners(ctx context.Context, group *errgroup.Group, namespace string, owners ownership) {
+	selector := o.selector(fmt.Sprintf(`namespace="%s"`, namespace))
+	for _, query := range []struct {
+		target map[string]ownerRef
+		query  string
+		label  prommodel.LabelName
+	}{
+		{owners.pods, fmt.Sprintf(podOwners, selector, o.Window), "pod"},
+		{owners.replicaSets, fmt.Sprintf(replicaSetOwners, selector, o.Window), "replicaset"},
+		{owners.jobs, fmt.Sprintf(jobOwners, selector, o.Window), "job_name"},
+	} {
+		group.Go(func() error {
+			response, err := queryPrometheus(ctx, o.promClient, query.query, o.at)
+			if err != nil {
+				return fmt.Errorf("error querying owners %w", err)
+			}
+			asSamples, ok := response.(prommodel.Vector)
+			if !ok {
+				return fmt.Errorf("error converting response to vector")
+			}
+			for _, sample := range asSamples {
+				query.target[string(sample.Metric[query.label])] = ownerRef{
+					Kind: string(sample.Metric["owner_kind"]),
+					Name: string(sample.Metric["owner_name"]),
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// listOwners finds the owners of the pods which currently exist in the namespace.
+func (o *Options) listOwners(ctx context.Context, namespace string) (ownership, error) {
+	owners := newOwnership()
+	controller := func(refs []metav1.OwnerReference) (ownerRef, bool) {
+		for _, ref := range refs {
+			if ref.Controller != nil && *ref.Controller {
+				return ownerRef{Kind: ref.Kind, Name: ref.Name}, true
+			}
+		}
+		return ownerRef{}, false
+	}
+
+	pods, err := o.Client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return owners, err
+	}
+	for _, pod := range pods.Items {
+		if owner, ok := controller(pod.OwnerReferences); ok {
+			owners.pods[pod.Name] = owner
+		}
+	}
+
+	replicaSets, err := o.Client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return owners, err
+	}
+	for _, replicaSet := range replicaSets.Items {
+		if owner, ok := controller(replicaSet.OwnerReferences); ok {
+			owners.replicaSets[replicaSet.Name] = owner
+		}
+	}
+
+	jobs, err := o.Client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return owners, err
+	}
+	for _, job := range jobs.Items {
+		if owner, ok := controller(job.OwnerReferences); ok {
+			owners.jobs[job.Name] = owner
+		}
+	}
+	return owners, nil
+}
+
+// workload returns the usage of the containers of the workload.
+func (n *namespaceMetrics) workload(workload Workload) Usage {
+	values := containerValues{}
+	for _, series := range []struct {
+		total  *map[string][]float64
+		series map[containerKey]float64
+	}{
+		{&values.RequestCPU, n.series.RequestCPU},
+		{&values.RequestMem, n.series.RequestMem},
+		{&values.LimitCPU, n.series.LimitCPU},
+		{&values.LimitMem, n.series.LimitMem},
+		{&values.PeakCPU, n.series.PeakCPU},
+		{&values.PeakMem, n.series.PeakMem},
+		{&values.Throttled, n.series.Throttled},
+		{&values.OOMKilled, n.series.OOMKilled},
+		{&values.Restarts, n.series.Restarts},
+	} {
+		*series.total = map[string][]float64{}
+		for k, v := range series.series {
+			if n.workloads[k.Pod] == workload {
+				(*series.total)[k.Container] = append((*series.total)[k.Container], v)
+			}
+		}
+	}
+	return values.peak()
+}
+
+// containerValues collects values of every pod by container name.
+type containerValues struct {
+	LimitCPU   map[string][]float64
+	LimitMem   map[string][]float64
+	RequestCPU map[string][]float64
+	RequestMem map[string][]float64
+	PeakCPU    map[string][]float64
+	PeakMem    map[string][]float64
+	Throttled  map[string][]float64
+	OOMKilled  map[string][]float64
+	Restarts   map[string][]float64
+}
+
+// peak returns the highest value of the pods of each container.
+func (c containerValues) peak() Usage {
+	peaks := func(values map[string][]float64) map[string]float64 {
+		peak := make(map[string]float64, len(values))
+		for k, v := range values {
+			peak[k] = float64Peak(v)
+		}
+		return peak
+	}
+	return Usage{
+		LimitCPU:   peaks(c.LimitCPU),
+		LimitMem:   peaks(c.LimitMem),
+		RequestCPU: peaks(c.RequestCPU),
+		RequestMem: peaks(c.RequestMem),
+		PeakCPU:    peaks(c.PeakCPU),
+		PeakMem:    peaks(c.PeakMem),
+		Throttled:  peaks(c.Throttled),
+		OOMKilled:  peaks(c.OOMKilled),
+		Restarts:   peaks(c.Restarts),
+	}
+}
@@ -0,0 +1,254 @@
+package advisor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func TestNamespaceMetricsWorkload(t *testing.T) {
+	web := Workload{Namespace: "ns", Kind: KindDeployment, Name: "web"}
+	worker := Workload{Namespace: "ns", Kind: KindDeployment, Name: "worker"}
+	n := namespaceMetrics{
+		workloads: map[string]Workload{"web-1": web, "web-2": web, "worker-1": worker},
+		series: seriesMetrics{
+			PeakCPU: map[containerKey]float64{
+				{Namespace: "ns", Pod: "web-1", Container: "app"}:        2,
+				{Namespace: "ns", Pod: "web-1", Container: "sidecar"}:    0.01,
+				{Namespace: "ns", Pod: "web-2", Container: "app"}:        1,
+				{Namespace: "ns", Pod: "web-2", Container: "sidecar"}:    0.02,
+				{Namespace: "ns", Pod: "worker-1", Container: "app"}:     4,
+				{Namespace: "ns", Pod: "worker-1", Container: "sidecar"}: 0.5,
+			},
+			PeakMem: map[containerKey]float64{
+				{Namespace: "ns", Pod: "web-1", Container: "app"}:     512,
+				{Namespace: "ns", Pod: "web-1", Container: "sidecar"}: 16,
+			},
+		},
+	}
+
+	usage := n.workload(web)
+	if expected := map[string]float64{"app": 2, "sidecar": 0.02}; !reflect.DeepEqual(usage.PeakCPU, expected) {
+		t.Errorf("expected cpu %v, got %v", expected, usage.PeakCPU)
+	}
+	if expected := map[string]float64{"app": 512, "sidecar": 16}; !reflect.DeepEqual(usage.PeakMem, expected) {
+		t.Errorf("expected memory %v, got %v", expected, usage.PeakMem)
+	}
+	if len(usage.RequestCPU) != 0 {
+		t.Errorf("expected no cpu requests, got %v", usage.RequestCPU)
+	}
+}
+
+func TestFetchNamespaceConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, highest, queries := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		queries++
+		highest = max(highest, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	o := &Options{Concurrency: 3, Prometheus: PrometheusOptions{URL: server.URL}}
+	o.loadDefaults()
+	client, err := makePrometheusClientForURL(o.Prometheus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.limit(o.Prometheus)
+	o.promClient, o.mode, o.history, o.at = client, ModeSumIrate, HistoryOwners, time.Now()
+	// namespaces are fetched in parallel like in analyze
+	group := errgroup.Group{}
+	for _, namespace := range []string{"a", "b"} {
+		group.Go(func() error {
+			_, err := o.fetchNamespace(context.Background(), namespace)
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	// 7 statistics and 3 owners for each namespace, the limits are based on the peaks
+	if queries != 20 {
+		t.Errorf("expected 20 queries, got %d", queries)
+	}
+	if highest > o.Concurrency || highest < 2 {
+		t.Errorf("expected between 2 and %d queries at the same time, got %d", o.Concurrency, highest)
+	}
+}
+
+func TestOwnershipResolve(t *testing.T) {
+	owners := ownership{
+		pods: map[string]ownerRef{
+			"web-5d8f-a":         {Kind: "ReplicaSet", Name: "web-5d8f"},
+			"web-7c9b-b":         {Kind: "ReplicaSet", Name: "web-7c9b"}, // replicaset removed by a rollout
+			"bare-x":             {Kind: "ReplicaSet", Name: "bare"},
+			"unknown-y":          {Kind: "ReplicaSet", Name: "unknown"},
+			"db-0":               {Kind: "StatefulSet", Name: "db"},
+			"agent-z":            {Kind: "DaemonSet", Name: "agent"},
+			"nightly-29000-q":    {Kind: "Job", Name: "nightly-29000"},
+			"backfill-r":         {Kind: "Job", Name: "backfill"},
+			"static-node":        {Kind: "Node", Name: "node"},
+			"operator-managed-s": {Kind: "Workflow", Name: "flow"},
+		},
+		replicaSets: map[string]ownerRef{
+			"web-5d8f": {Kind: "Deployment", Name: "web"},
+			"web-7c9b": {Kind: "Deployment", Name: "web"},
+			"bare":     {Kind: "Rollout", Name: "bare"},
+		},
+		jobs: map[string]ownerRef{
+			"nightly-29000": {Kind: "CronJob", Name: "nightly"},
+		},
+	}
+	expected := map[string]Workload{
+		"web-5d8f-a":      {Namespace: "ns", Kind: KindDeployment, Name: "web"},
+		"web-7c9b-b":      {Namespace: "ns", Kind: KindDeployment, Name: "web"},
+		"db-0":            {Namespace: "ns", Kind: KindStatefulSet, Name: "db"},
+		"agent-z":         {Namespace: "ns", Kind: KindDaemonSet, Name: "agent"},
+		"nightly-29000-q": {Namespace: "ns", Kind: KindCronJob, Name: "nightly"},
+		"backfill-r":      {Namespace: "ns", Kind: KindJob, Name: "backfill"},
+	}
+	if actual := owners.resolve("ns"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestQueryOwners(t *testing.T) {
+	responses := map[string]string{
+		"kube_pod_owner": `[
+			{"metric":{"pod":"web-5d8f-a","owner_kind":"ReplicaSet","owner_name":"web-5d8f"},"value":[0,"1"]},
+			{"metric":{"pod":"nightly-29000-q","owner_kind":"Job","owner_name":"nightly-29000"},"value":[0,"1"]}
+		]`,
+		"kube_replicaset_owner": `[{"metric":{"replicaset":"web-5d8f","owner_kind":"Deployment","owner_name":"web"},"value":[0,"1"]}]`,
+		"kube_job_owner":        `[{"metric":{"job_name":"nightly-29000","owner_kind":"CronJob","owner_name":"nightly"},"value":[0,"1"]}]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		query := r.Form.Get("query")
+		result := "[]"
+		for metric, response := range responses {
+			if strings.Contains(query, metric+`{namespace="ns", cluster="prod"}[2w]`) {
+				result = response
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + result + `}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	o := &Options{Window: "2w", Prometheus: PrometheusOptions{URL: server.URL, Matchers: []string{`cluster="prod"`}}}
+	o.loadDefaults()
+	client, err := makePrometheusClientForURL(o.Prometheus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.promClient, o.at = client, time.Now()
+
+	owners := newOwnership()
+	group, ctx := errgroup.WithContext(context.Background())
+	o.queryOwners(ctx, group, "ns", owners)
+	if err := group.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Workload{
+		"web-5d8f-a":      {Namespace: "ns", Kind: KindDeployment, Name: "web"},
+		"nightly-29000-q": {Namespace: "ns", Kind: KindCronJob, Name: "nightly"},
+	}
+	if actual := owners.resolve("ns"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFetchNamespace(t *testing.T) {
+	var mu sync.Mutex
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		query := r.Form.Get("query")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+		result := "[]"
+		switch {
+		case strings.HasPrefix(query, "max by (namespace, pod, container) (quantile_over_time(0.95, node_namespace_pod_container"):
+			result = `[
+				{"metric":{"namespace":"ns","pod":"web-1-a","container":"app"},"value":[0,"0.1"]},
+				{"metric":{"namespace":"ns","pod":"web-1-b","container":"app"},"value":[0,"0.3"]},
+				{"metric":{"namespace":"ns","pod":"worker-1-a","container":"app"},"value":[0,"0.5"]},
+				{"metric":{"namespace":"ns","pod":"orphan","container":"app"},"value":[0,"1"]}
+			]`
+		case strings.HasPrefix(query, "max by (namespace, pod, container) (max_over_time(node_namespace_pod_container"):
+			result = `[{"metric":{"namespace":"ns","pod":"web-1-a","container":"app"},"value":[0,"0.4"]}]`
+		case strings.Contains(query, "kube_pod_owner"):
+			result = `[
+				{"metric":{"pod":"web-1-a","owner_kind":"ReplicaSet","owner_name":"web-1"},"value":[0,"1"]},
+				{"metric":{"pod":"web-1-b","owner_kind":"ReplicaSet","owner_name":"web-1"},"value":[0,"1"]},
+				{"metric":{"pod":"worker-1-a","owner_kind":"ReplicaSet","owner_name":"worker-1"},"value":[0,"1"]}
+			]`
+		case strings.Contains(query, "kube_replicaset_owner"):
+			result = `[
+				{"metric":{"replicaset":"web-1","owner_kind":"Deployment","owner_name":"web"},"value":[0,"1"]},
+				{"metric":{"replicaset":"worker-1","owner_kind":"Deployment","owner_name":"worker"},"value":[0,"1"]}
+			]`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + result + `}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	o := &Options{Prometheus: PrometheusOptions{URL: server.URL}}
+	o.loadDefaults()
+	client, err := makePrometheusClientForURL(o.Prometheus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.promClient, o.mode, o.history, o.at = client, ModeSumIrate, HistoryOwners, time.Now()
+	metrics, err := o.fetchNamespace(context.Background(), "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every query covers the whole namespace
+	for _, query := range queries {
+		if !strings.Contains(query, `namespace="ns"`) {
+			t.Errorf("expected query scoped to namespace ns, got %s", query)
+		}
+	}
+	// without limit templates the limits are based on the peak usage
+	if actual := metrics.workload(Workload{Namespace: "ns", Kind: KindDeployment, Name: "web"}).LimitCPU; !reflect.DeepEqual(actual, map[string]float64{"app": 0.4}) {
+		t.Errorf("expected the peak cpu as limit, got %v", actual)
+	}
+	for _, tc := range []struct {
+		workload Workload
+		expected map[string]float64
+	}{
+		{Workload{Namespace: "ns", Kind: KindDeployment, Name: "web"}, map[string]float64{"app": 0.3}},
+		{Workload{Namespace: "ns", Kind: KindDeployment, Name: "worker"}, map[string]float64{"app": 0.5}},
+		{Workload{Namespace: "ns", Kind: KindDeployment, Name: "other"}, map[string]float64{}},
+	} {
+		t.Run(tc.workload.Name, func(t *testing.T) {
+			if actual := metrics.workload(tc.workload).RequestCPU; !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected cpu requests %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package advisor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	prommodel "github.com/prometheus/common/model"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Supported output formats.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputCSV   = "csv"
+)
+
+// ReportVersion is the schema version of the machine-readable report. It is bumped
+// whenever fields are renamed or removed, adding fields does not change it.
+const ReportVersion = "v1"
+
+// Report is the machine-readable representation of a resource-advisor run.
+type Report struct {
+	Version    string         `json:"version"`
+	Settings   ReportSettings `json:"settings"`
+	Mode       string         `json:"mode"`
+	History    string         `json:"history"`
+	Confidence string         `json:"confidence"`
+	Rows       []ReportRow    `json:"rows"`
+	Totals     ReportSavings  `json:"totals"`             // cronjobs and jobs are not included
+	Warnings   []string       `json:"warnings,omitempty"` // workloads whose QoS class would change
+}
+
+// Confidence of the recommendations.
+const (
+	ConfidenceNormal = "normal"
+	ConfidenceLow    = "low" // usage covers only a short window
+)
+
+// ReportSettings contains the settings used to produce the report.
+type ReportSettings struct {
+	Namespaces  []string `json:"namespaces"`
+	Quantile    string   `json:"quantile"`
+	LimitMargin string   `json:"limitMargin"`
+	Window      string   `json:"window"`
+	At          string   `json:"at"`
+	Strategy    string   `json:"strategy"`
+	LimitPolicy string   `json:"limitPolicy"`
+}
+
+// ReportRow contains the recommendation for a single container.
+type ReportRow struct {
+	Namespace string          `json:"namespace"`
+	Kind      string          `json:"kind"`
+	Name      string          `json:"name"`
+	Container string          `json:"container"`
+	Type      string          `json:"type"`
+	Replicas  int32           `json:"replicas"`
+	Requests  ReportResources `json:"requests"`
+	Limits    ReportResources `json:"limits"`
+	Savings   ReportSavings   `json:"savings"`
+	Risk      []string        `json:"risk,omitempty"` // reasons the container may be under-provisioned
+}
+
+// ReportResources contains the cpu and memory values of a request or limit.
+type ReportResources struct {
+	CPU    ReportValue `json:"cpu"`
+	Memory ReportValue `json:"memory"`
+}
+
+// ReportValue contains the recommended and the currently configured value as Kubernetes quantities.
+// Current is empty when the value is not set in the workload spec and Recommended is empty when no
+// limit is recommended.
+type ReportValue struct {
+	Recommended string `json:"recommended"`
+	Current     string `json:"current,omitempty"`
+}
+
+// ReportSavings contains cpu savings in cores and memory savings in bytes. Negative values mean
+// that the recommendation requests more than what is currently requested.
+type ReportSavings struct {
+	CPU    float64 `json:"cpu"`
+	Memory int64   `json:"memory"`
+}
+
+func validateOutput(output string) error {
+	switch output {
+	case OutputTable, OutputJSON, OutputYAML, OutputCSV:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format '%s', supported formats are %s, %s, %s and %s", output, OutputTable, OutputJSON, OutputYAML, OutputCSV)
+}
+
+// window returns the lookback window the usage covers.
+func (o *Options) window() string {
+	if o.mode == ModeMetricsServer {
+		return prommodel.Duration(o.SampleDuration).String()
+	}
+	return o.Window
+}
+
+func (o *Options) confidence() string {
+	if o.mode == ModeMetricsServer {
+		return ConfidenceLow
+	}
+	return ConfidenceNormal
+}
+
+func (o *Options) buildReport(resp *Response) Report {
+	rows := make([]ReportRow, 0, len(resp.Recommendations))
+	for _, rec := range resp.Recommendations {
+		rows = append(rows, reportRow(rec))
+	}
+	return Report{
+		Version: ReportVersion,
+		Settings: ReportSettings{
+			Namespaces:  strings.Split(o.usedNamespaces, ","),
+			Quantile:    o.Quantile,
+			LimitMargin: o.LimitMargin,
+			Window:      o.window(),
+			At:          o.at.UTC().Format(time.RFC3339),
+			Strategy:    o.strategy(),
+			LimitPolicy: o.LimitPolicy.String(),
+		},
+		Mode:       o.mode,
+		History:    o.history,
+		Confidence: o.confidence(),
+		Rows:       rows,
+		Totals:     resp.Totals,
+		Warnings:   resp.Warnings,
+	}
+}
+
+func (o *Options) render(w io.Writer, resp *Response) error {
+	switch o.Output {
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(o.buildReport(resp))
+	case OutputYAML:
+		out, err := yaml.Marshal(o.buildReport(resp))
+		if err != nil {
+			return fmt.Errorf("failed to marshal yaml: %w", err)
+		}
+		_, err = w.Write(out)
+		return err
+	case OutputCSV:
+		return renderCSV(w, o.buildReport(resp))
+	}
+	return o.renderTable(w, resp)
+}
+
+func (o *Options) renderTable(w io.Writer, resp *Response) error {
+	fmt.Fprintf(w, "Namespaces: %s\n", o.usedNamespaces)
+	fmt.Fprintf(w, "Quantile: %s\n", o.Quantile)
+	fmt.Fprintf(w, "Limit margin: %s\n", o.LimitMargin)
+	fmt.Fprintf(w, "Limit policy: %s\n", o.LimitPolicy)
+	fmt.Fprintf(w, "Window: %s\n", o.window())
+	fmt.Fprintf(w, "At: %s\n", o.at.UTC().Format(time.RFC3339))
+	if o.strategy() == StrategyHistogram {
+		fmt.Fprintf(w, "Strategy: %s (%s)\n", o.strategy(), o.Histogram)
+	} else {
+		fmt.Fprintf(w, "Strategy: %s\n", o.strategy())
+	}
+	fmt.Fprintf(w, "Using mode: %s\n", o.mode)
+	fmt.Fprintf(w, "Using history: %s\n", o.history)
+	if o.confidence() == ConfidenceLow {
+		fmt.Fprintf(w, "Confidence: %s, usage sampled from metrics-server for %s only\n", ConfidenceLow, o.window())
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.Header("Namespace", "Resource", "Container", "Request CPU (spec)", "Request MEM (spec)", "Limit CPU (spec)", "Limit MEM (spec)", "Risk")
+	for _, rec := range resp.Recommendations {
+		_ = table.Append(tableRow(reportRow(rec)))
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("failed to render table: %w", err)
+	}
+
+	fmt.Fprintf(w, "Total savings:\n")
+
+	totalMem := resp.Totals.Memory
+	totalMemStr := byteCountSI(totalMem)
+	if totalMem < 0 {
+		totalMemStr = fmt.Sprintf("-%s", byteCountSI(-1*totalMem))
+	}
+	fmt.Fprintf(w, "You could save %.2f vCPUs and %s Memory by changing the settings\n", resp.Totals.CPU, totalMemStr)
+	for _, rec := range resp.Recommendations {
+		if isBatch(rec.Kind) {
+			fmt.Fprintf(w, "Savings of cronjobs and jobs are not included in the total\n")
+			break
+		}
+	}
+	for _, warning := range resp.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	return nil
+}
+
+func renderCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"namespace", "kind", "name", "container", "replicas",
+		"request_cpu", "request_cpu_current", "request_memory", "request_memory_current",
+		"limit_cpu", "limit_cpu_current", "limit_memory", "limit_memory_current",
+		"savings_cpu", "savings_memory", "type", "risk",
+	})
+	for _, row := range report.Rows {
+		_ = cw.Write([]string{
+			row.Namespace, row.Kind, row.Name, row.Container, strconv.Itoa(int(row.Replicas)),
+			row.Requests.CPU.Recommended, row.Requests.CPU.Current, row.Requests.Memory.Recommended, row.Requests.Memory.Current,
+			row.Limits.CPU.Recommended, row.Limits.CPU.Current, row.Limits.Memory.Recommended, row.Limits.Memory.Current,
+			strconv.FormatFloat(row.Savings.CPU, 'f', 3, 64), strconv.FormatInt(row.Savings.Memory, 10), row.Type, strings.Join(row.Risk, ","),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func reportRow(rec Recommendation) ReportRow {
+	return ReportRow{
+		Namespace: rec.Namespace,
+		Kind:      rec.Kind,
+		Name:      rec.Name,
+		Container: rec.Container,
+		Type:      rec.ContainerType,
+		Replicas:  rec.Replicas,
+		Requests: ReportResources{
+			CPU:    reportValue(rec.Current.Requests, rec.Recommended.Requests, v1.ResourceCPU),
+			Memory: reportValue(rec.Current.Requests, rec.Recommended.Requests, v1.ResourceMemory),
+		},
+		Limits: ReportResources{
+			CPU:    reportValue(rec.Current.Limits, rec.Recommended.Limits, v1.ResourceCPU),
+			Memory: reportValue(rec.Current.Limits, rec.Recommended.Limits, v1.ResourceMemory),
+		},
+		Savings: ReportSavings{CPU: rec.CPUSave, Memory: int64(rec.MemSave)},
+		Risk:    rec.Risk,
+	}
+}
+
+func reportValue(current v1.ResourceList, recommended v1.ResourceList, name v1.ResourceName) ReportValue {
+	value := ReportValue{}
+	if rec, ok := recommended[name]; ok {
+		value.Recommended = rec.String()
+	}
+	if cur, ok := current[name]; ok {
+		value.Current = cur.String()
+	}
+	return value
+}
+
+// tableRow formats a report row in the "recommended (current)" format used by the table output.
+func tableRow(row ReportRow) []string {
+	return []string{
+		row.Namespace,
+		fmt.Sprintf("%s/%s", row.Kind, row.Name),
+		tableContainer(row.Container, row.Type),
+		fmt.Sprintf("%s (%s)", row.Requests.CPU.Recommended, tableValue(row.Requests.CPU.Current)),
+		fmt.Sprintf("%s (%s)", row.Requests.Memory.Recommended, tableValue(row.Requests.Memory.Current)),
+		fmt.Sprintf("%s (%s)", tableValue(row.Limits.CPU.Recommended), tableValue(row.Limits.CPU.Current)),
+		fmt.Sprintf("%s (%s)", tableValue(row.Limits.Memory.Recommended), tableValue(row.Limits.Memory.Current)),
+		strings.Join(row.Risk, ","),
+	}
+}
+
+// tableContainer marks init containers and sidecars in the container column.
+func tableContainer(name string, containerType string) string {
+	if containerType == ContainerTypeInit || containerType == ContainerTypeSidecar {
+		return fmt.Sprintf("%s (%s)", name, containerType)
+	}
+	return name
+}
+
+func tableValue(value string) string {
+	if value == "" {
+		return "<nil>"
+	}
+	return value
+}
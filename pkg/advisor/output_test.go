@@ -0,0 +1,169 @@
+package advisor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// outputOptions returns options of a finished run in namespace ns.
+func outputOptions(output string) *Options {
+	o := &Options{Output: output, usedNamespaces: "ns", mode: ModeSumIrate, history: HistoryOwners, at: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	o.loadDefaults()
+	return o
+}
+
+func outputResponse() *Response {
+	return &Response{
+		Recommendations: []Recommendation{
+			{
+				Namespace: "ns", Kind: KindDeployment, Name: "web", Container: "app", ContainerType: ContainerTypeApp, Replicas: 2,
+				Current: v1.ResourceRequirements{Requests: resourceList("500m", "1Gi")},
+				Recommended: v1.ResourceRequirements{
+					Requests: resourceList("200m", "300Mi"),
+					Limits:   resourceList("", "600Mi"),
+				},
+				CPUSave: 0.6,
+				MemSave: 2 * 724 * 1024 * 1024,
+				Risk:    []string{RiskRestarts},
+			},
+			{
+				Namespace: "ns", Kind: KindDeployment, Name: "web", Container: "proxy", ContainerType: ContainerTypeSidecar, Replicas: 2,
+				Recommended: v1.ResourceRequirements{Requests: resourceList("100m", "100Mi")},
+				CPUSave:     -0.2,
+				MemSave:     -2 * 100 * 1024 * 1024,
+			},
+		},
+		Totals:   ReportSavings{CPU: 0.4, Memory: 2 * 624 * 1024 * 1024},
+		Warnings: []string{"deployment/web in namespace ns would change QoS class from BestEffort to Burstable"},
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	for _, output := range []string{OutputTable, OutputJSON, OutputYAML, OutputCSV} {
+		if err := validateOutput(output); err != nil {
+			t.Errorf("%s: %v", output, err)
+		}
+	}
+	if err := validateOutput("xml"); err == nil || !strings.Contains(err.Error(), "unsupported output format 'xml'") {
+		t.Errorf("expected unsupported output format, got %v", err)
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	expected := Report{
+		Version: ReportVersion,
+		Settings: ReportSettings{
+			Namespaces:  []string{"ns"},
+			Quantile:    "0.95",
+			LimitMargin: "1.2",
+			Window:      "1w",
+			At:          "2026-01-02T03:04:05Z",
+			Strategy:    StrategyQuantile,
+			LimitPolicy: "cpu margin, memory margin",
+		},
+		Mode:       ModeSumIrate,
+		History:    HistoryOwners,
+		Confidence: ConfidenceNormal,
+		Rows: []ReportRow{
+			{
+				Namespace: "ns", Kind: KindDeployment, Name: "web", Container: "app", Type: ContainerTypeApp, Replicas: 2,
+				Requests: ReportResources{
+					CPU:    ReportValue{Recommended: "200m", Current: "500m"},
+					Memory: ReportValue{Recommended: "300Mi", Current: "1Gi"},
+				},
+				Limits: ReportResources{
+					Memory: ReportValue{Recommended: "600Mi"},
+				},
+				Savings: ReportSavings{CPU: 0.6, Memory: 2 * 724 * 1024 * 1024},
+				Risk:    []string{RiskRestarts},
+			},
+			{
+				Namespace: "ns", Kind: KindDeployment, Name: "web", Container: "proxy", Type: ContainerTypeSidecar, Replicas: 2,
+				Requests: ReportResources{
+					CPU:    ReportValue{Recommended: "100m"},
+					Memory: ReportValue{Recommended: "100Mi"},
+				},
+				Savings: ReportSavings{CPU: -0.2, Memory: -2 * 100 * 1024 * 1024},
+			},
+		},
+		Totals:   ReportSavings{CPU: 0.4, Memory: 2 * 624 * 1024 * 1024},
+		Warnings: []string{"deployment/web in namespace ns would change QoS class from BestEffort to Burstable"},
+	}
+
+	for _, tc := range []struct {
+		output    string
+		unmarshal func([]byte, interface{}) error
+	}{
+		{OutputJSON, json.Unmarshal},
+		{OutputYAML, func(data []byte, v interface{}) error { return yaml.UnmarshalStrict(data, v) }},
+	} {
+		t.Run(tc.output, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			if err := outputOptions(tc.output).render(out, outputResponse()); err != nil {
+				t.Fatal(err)
+			}
+			report := Report{}
+			if err := tc.unmarshal(out.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("expected %+v, got %+v", expected, report)
+			}
+		})
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := outputOptions(OutputCSV).render(out, outputResponse()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{
+			"namespace", "kind", "name", "container", "replicas",
+			"request_cpu", "request_cpu_current", "request_memory", "request_memory_current",
+			"limit_cpu", "limit_cpu_current", "limit_memory", "limit_memory_current",
+			"savings_cpu", "savings_memory", "type", "risk",
+		},
+		{"ns", "deployment", "web", "app", "2", "200m", "500m", "300Mi", "1Gi", "", "", "600Mi", "", "0.600", "1518338048", "app", "restarts"},
+		{"ns", "deployment", "web", "proxy", "2", "100m", "", "100Mi", "", "", "", "", "", "-0.200", "-209715200", "sidecar", ""},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := outputOptions(OutputTable).render(out, outputResponse()); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Namespaces: ns\n",
+		"Window: 1w\n",
+		"At: 2026-01-02T03:04:05Z\n",
+		"Using mode: sum_irate\n",
+		"200m (500m)",
+		"<nil> (<nil>)",
+		"600Mi (<nil>)",
+		"proxy (sidecar)",
+		"You could save 0.40 vCPUs and 1.3 GB Memory by changing the settings\n",
+		"Warning: deployment/web in namespace ns would change QoS class from BestEffort to Burstable\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected table to contain %q, got\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package advisor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Supported patch formats.
+const (
+	PatchStrategic = "strategic"
+	PatchJSON      = "json"
+)
+
+// workloadRecommendations contains the recommendations for the containers of a single workload.
+type workloadRecommendations struct {
+	Namespace       string
+	Kind            string
+	Name            string
+	Annotations     map[string]string
+	Recommendations []Recommendation
+}
+
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func (o *Options) validatePatches() error {
+	if o.PatchFile != "" && o.PatchDir != "" {
+		return fmt.Errorf("patch file and patch directory can not be used together")
+	}
+	switch o.PatchFormat {
+	case PatchStrategic, PatchJSON:
+		return nil
+	}
+	return fmt.Errorf("unsupported patch format '%s', supported formats are %s and %s", o.PatchFormat, PatchStrategic, PatchJSON)
+}
+
+// hasUsage reports whether there was any usage data for the container. Containers without
+// usage data get zero recommendations which must not be written back to workloads.
+func hasUsage(rec Recommendation) bool {
+	return !rec.Recommended.Requests.Cpu().IsZero() || !rec.Recommended.Requests.Memory().IsZero()
+}
+
+// groupByWorkload groups recommendations by workload keeping the original order. Containers
+// without usage data are left out and so are workloads without any recommendations. Jobs are left
+// out as well because their pod template can not be changed.
+func groupByWorkload(recommendations []Recommendation) []workloadRecommendations {
+	workloads := []workloadRecommendations{}
+	index := map[string]int{}
+	for _, rec := range recommendations {
+		if !hasUsage(rec) || rec.Kind == KindJob {
+			continue
+		}
+		key := fmt.Sprintf("%s/%s/%s", rec.Namespace, rec.Kind, rec.Name)
+		i, ok := index[key]
+		if !ok {
+			i = len(workloads)
+			index[key] = i
+			workloads = append(workloads, workloadRecommendations{
+				Namespace: rec.Namespace,
+				Kind:      rec.Kind,
+				Name:      rec.Name,
+			})
+		}
+		workloads[i].Recommendations = append(workloads[i].Recommendations, rec)
+	}
+	return workloads
+}
+
+func (w workloadRecommendations) podTemplate() *corev1ac.PodTemplateSpecApplyConfiguration {
+	spec := corev1ac.PodSpec()
+	for _, rec := range w.Recommendations {
+		resources := corev1ac.ResourceRequirements()
+		if len(rec.Recommended.Requests) > 0 {
+			resources.WithRequests(rec.Recommended.Requests)
+		}
+		if len(rec.Recommended.Limits) > 0 {
+			resources.WithLimits(rec.Recommended.Limits)
+		}
+		container := corev1ac.Container().WithName(rec.Container).WithResources(resources)
+		if rec.ContainerType == ContainerTypeInit || rec.ContainerType == ContainerTypeSidecar {
+			spec.WithInitContainers(container)
+		} else {
+			spec.WithContainers(container)
+		}
+	}
+	return corev1ac.PodTemplateSpec().WithSpec(spec)
+}
+
+// applyConfiguration returns the workload with only the container resources set. It can be used
+// as strategic merge patch and as server-side apply configuration.
+func (w workloadRecommendations) applyConfiguration() (interface{}, error) {
+	switch w.Kind {
+	case KindDeployment:
+		return appsv1ac.Deployment(w.Name, w.Namespace).
+			WithAnnotations(w.Annotations).
+			WithSpec(appsv1ac.DeploymentSpec().WithTemplate(w.podTemplate())), nil
+	case KindStatefulSet:
+		return appsv1ac.StatefulSet(w.Name, w.Namespace).
+			WithAnnotations(w.Annotations).
+			WithSpec(appsv1ac.StatefulSetSpec().WithTemplate(w.podTemplate())), nil
+	case KindDaemonSet:
+		return appsv1ac.DaemonSet(w.Name, w.Namespace).
+			WithAnnotations(w.Annotations).
+			WithSpec(appsv1ac.DaemonSetSpec().WithTemplate(w.podTemplate())), nil
+	case KindCronJob:
+		return batchv1ac.CronJob(w.Name, w.Namespace).
+			WithAnnotations(w.Annotations).
+			WithSpec(batchv1ac.CronJobSpec().WithJobTemplate(batchv1ac.JobTemplateSpec().
+				WithSpec(batchv1ac.JobSpec().WithTemplate(w.podTemplate())))), nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind '%s'", w.Kind)
+}
+
+// mergeResources returns current resources overridden by the recommended ones such that
+// resources the advisor does not know about are preserved. Cpu and memory are taken only from the
+// recommended resources, so a limit which is not recommended is removed.
+func mergeResources(current v1.ResourceList, recommended v1.ResourceList) v1.ResourceList {
+	merged := v1.ResourceList{}
+	for k, v := range current {
+		if k != v1.ResourceCPU && k != v1.ResourceMemory {
+			merged[k] = v
+		}
+	}
+	for k, v := range recommended {
+		merged[k] = v
+	}
+	return merged
+}
+
+// removedLimits returns the cpu and memory limits of the container which the recommendation does
+// not set.
+func removedLimits(rec Recommendation) []v1.ResourceName {
+	removed := []v1.ResourceName{}
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		_, current := rec.Current.Limits[name]
+		_, recommended := rec.Recommended.Limits[name]
+		if current && !recommended {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+func (w workloadRecommendations) removesLimits() bool {
+	for _, rec := range w.Recommendations {
+		if len(removedLimits(rec)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// strategicPatch returns the apply configuration as strategic merge patch. Limits removed by the
+// recommendations are set to null, which removes them when the patch is applied.
+func (w workloadRecommendations) strategicPatch() (interface{}, error) {
+	cfg, err := w.applyConfiguration()
+	if err != nil || !w.removesLimits() {
+		return cfg, err
+	}
+	patch, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert patch for %s/%s: %w", w.Kind, w.Name, err)
+	}
+	podSpec := []string{"spec", "template", "spec"}
+	if w.Kind == KindCronJob {
+		podSpec = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	for _, field := range []string{"containers", "initContainers"} {
+		path := append(append([]string{}, podSpec...), field)
+		containers, found, err := unstructured.NestedSlice(patch, path...)
+		if err != nil || !found {
+			continue
+		}
+		for _, item := range containers {
+			container, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, rec := range w.Recommendations {
+				if rec.Container != container["name"] {
+					continue
+				}
+				for _, name := range removedLimits(rec) {
+					if err := unstructured.SetNestedField(container, nil, "resources", "limits", string(name)); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		if err := unstructured.SetNestedSlice(patch, containers, path...); err != nil {
+			return nil, err
+		}
+	}
+	return patch, nil
+}
+
+// jsonPatch returns RFC 6902 operations for the workload. The container name is tested before
+// changing the resources to make sure that the container index still matches.
+func (w workloadRecommendations) jsonPatch() []jsonPatchOperation {
+	template := "/spec/template"
+	if w.Kind == KindCronJob {
+		template = "/spec/jobTemplate/spec/template"
+	}
+	ops := []jsonPatchOperation{}
+	for _, rec := range w.Recommendations {
+		containers := "containers"
+		if rec.ContainerType == ContainerTypeInit || rec.ContainerType == ContainerTypeSidecar {
+			containers = "initContainers"
+		}
+		path := fmt.Sprintf("%s/spec/%s/%d", template, containers, rec.index)
+		ops = append(ops,
+			jsonPatchOperation{Op: "test", Path: path + "/name", Value: rec.Container},
+			jsonPatchOperation{Op: "add", Path: path + "/resources/requests", Value: mergeResources(rec.Current.Requests, rec.Recommended.Requests)},
+			jsonPatchOperation{Op: "add", Path: path + "/resources/limits", Value: mergeResources(rec.Current.Limits, rec.Recommended.Limits)},
+		)
+	}
+	return ops
+}
+
+func (w workloadRecommendations) patch(format string) ([]byte, error) {
+	var doc interface{}
+	header := fmt.Sprintf("# kubectl patch %s %s -n %s --type %s --patch-file <file>\n", w.Kind, w.Name, w.Namespace, format)
+	if format == PatchJSON {
+		doc = w.jsonPatch()
+	} else {
+		var err error
+		doc, err = w.strategicPatch()
+		if err != nil {
+			return nil, err
+		}
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal patch for %s/%s: %w", w.Kind, w.Name, err)
+	}
+	return append([]byte(header), out...), nil
+}
+
+func (o *Options) writePatches(recommendations []Recommendation) error {
+	if o.PatchDir != "" {
+		if err := os.MkdirAll(o.PatchDir, 0o750); err != nil {
+			return fmt.Errorf("failed to create patch directory: %w", err)
+		}
+	}
+	docs := []string{}
+	for _, workload := range groupByWorkload(recommendations) {
+		patch, err := workload.patch(o.PatchFormat)
+		if err != nil {
+			return err
+		}
+		if o.PatchDir != "" {
+			name := filepath.Join(o.PatchDir, fmt.Sprintf("%s.%s.%s.yaml", workload.Namespace, workload.Kind, workload.Name))
+			if err := os.WriteFile(name, patch, 0o600); err != nil {
+				return fmt.Errorf("failed to write patch: %w", err)
+			}
+			continue
+		}
+		docs = append(docs, string(patch))
+	}
+	if o.PatchFile != "" {
+		if err := os.WriteFile(o.PatchFile, []byte(strings.Join(docs, "---\n")), 0o600); err != nil {
+			return fmt.Errorf("failed to write patch: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// unstructuredContainers returns the containers or the init containers of an unstructured deployment.
+func unstructuredContainers(t *testing.T, content map[string]interface{}, field string) []map[string]interface{} {
+	t.Helper()
+	items, _, err := unstructured.NestedSlice(content, "spec", "template", "spec", field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := []map[string]interface{}{}
+	for _, item := range items {
+		container, ok := item.(map[string]interface{})
+		if !ok {
+			t.Fatalf("expected container, got %T", item)
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
+
+func unstructuredLimits(container map[string]interface{}) map[string]interface{} {
+	limits, _, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits")
+	asMap, _ := limits.(map[string]interface{})
+	return asMap
+}
+
+func TestAnalyzePatches(t *testing.T) {
+	o := &Options{LimitPolicy: LimitPolicy{CPU: LimitPolicyNone}}
+	resp := analyzeFake(t, o, fakeSource{web: webUsage()}, webDeployment())
+	workloads := groupByWorkload(resp.Recommendations)
+	if len(workloads) != 1 {
+		t.Fatalf("expected 1 workload, got %v", workloads)
+	}
+	workload := workloads[0]
+	if !workload.removesLimits() {
+		t.Fatal("expected the cpu limit of app to be removed")
+	}
+
+	t.Run("strategic", func(t *testing.T) {
+		patch, err := workload.strategicPatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, ok := patch.(map[string]interface{})
+		if !ok {
+			t.Fatalf("expected unstructured patch, got %T", patch)
+		}
+		containers := unstructuredContainers(t, content, "containers")
+		if len(containers) != 1 {
+			t.Fatalf("expected 1 container, got %v", containers)
+		}
+		limits := unstructuredLimits(containers[0])
+		if value, ok := limits["cpu"]; !ok || value != nil {
+			t.Errorf("expected cpu limit set to null, got %v", limits)
+		}
+		if limits["memory"] != "600Mi" {
+			t.Errorf("expected memory limit 600Mi, got %v", limits["memory"])
+		}
+		for _, container := range unstructuredContainers(t, content, "initContainers") {
+			if _, ok := unstructuredLimits(container)["cpu"]; ok {
+				t.Errorf("expected no cpu limit for init containers without a current limit, got %v", container)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		ops := workload.jsonPatch()
+		expected := map[string]string{
+			"/spec/template/spec/initContainers/0/name": "migrate",
+			"/spec/template/spec/initContainers/1/name": "proxy",
+			"/spec/template/spec/containers/0/name":     "app",
+		}
+		tests := map[string]string{}
+		for _, op := range ops {
+			if op.Op == "test" {
+				tests[op.Path] = op.Value.(string) //nolint:forcetypeassert // always the container name
+			}
+			if op.Path == "/spec/template/spec/containers/0/resources/limits" {
+				limits := op.Value.(v1.ResourceList) //nolint:forcetypeassert // always a resource list
+				assertQuantity(t, "app limits", limits, v1.ResourceCPU, "")
+				assertQuantity(t, "app limits", limits, v1.ResourceMemory, "600Mi")
+			}
+		}
+		if !reflect.DeepEqual(tests, expected) {
+			t.Errorf("expected test operations %v, got %v", expected, tests)
+		}
+		if len(ops) != 9 {
+			t.Errorf("expected 3 operations for each container, got %d", len(ops))
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package advisor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// tenantHeader is the header used by Mimir, Cortex and Thanos to select the tenant.
+const tenantHeader = "X-Scope-OrgID"
+
+// matcherPattern matches a single PromQL label matcher such as cluster="prod".
+var matcherPattern = regexp.MustCompile(`^\s*[a-zA-Z_][a-zA-Z0-9_]*\s*(=|!=|=~|!~)\s*"(?:[^"\\]|\\.)*"\s*$`)
+
+// PrometheusOptions contains settings for connecting directly to a Prometheus compatible HTTP API.
+// When URL is empty Prometheus is discovered from the cluster and accessed through the API server.
+// Tenant and Matchers are used with both.
+type PrometheusOptions struct {
+	URL                string
+	BearerToken        string
+	BearerTokenFile    string
+	Username           string
+	Password           string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	Headers            map[string]string
+	Tenant             string        // sent in the X-Scope-OrgID header
+	Matchers           []string      // label matchers added to every query, for example cluster="prod"
+	QueryRate          float64       // queries per second, 0 means unlimited
+	MaxInFlight        int           // queries running at the same time, defaults to the concurrency
+	Timeout            time.Duration // timeout of a single query, defaults to 5 minutes
+}
+
+func (p PrometheusOptions) validate() error {
+	if p.QueryRate < 0 {
+		return fmt.Errorf("prometheus query rate can not be negative")
+	}
+	if p.MaxInFlight < 0 {
+		return fmt.Errorf("prometheus max in-flight queries can not be negative")
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("prometheus timeout can not be negative")
+	}
+	if p.URL == "" {
+		// tenant and matchers are used with the discovered prometheus too
+		for _, option := range []struct {
+			flag string
+			set  bool
+		}{
+			{"token", p.BearerToken != ""},
+			{"token-file", p.BearerTokenFile != ""},
+			{"username", p.Username != ""},
+			{"password", p.Password != ""},
+			{"ca-file", p.CAFile != ""},
+			{"cert-file", p.CertFile != ""},
+			{"key-file", p.KeyFile != ""},
+			{"insecure-skip-verify", p.InsecureSkipVerify},
+			{"header", len(p.Headers) > 0},
+		} {
+			if option.set {
+				return fmt.Errorf("--prometheus-%s requires --prometheus-url, the discovered prometheus is accessed with the kubeconfig credentials", option.flag)
+			}
+		}
+	}
+	for _, matcher := range p.Matchers {
+		if !matcherPattern.MatchString(matcher) {
+			return fmt.Errorf("invalid prometheus label matcher '%s', expected for example cluster=\"prod\"", matcher)
+		}
+	}
+	return nil
+}
+
+// selector returns a PromQL selector of the matchers together with the configured extra matchers.
+func (o *Options) selector(matchers ...string) string {
+	all := make([]string, 0, len(matchers)+len(o.Prometheus.Matchers))
+	all = append(all, matchers...)
+	for _, matcher := range o.Prometheus.Matchers {
+		all = append(all, strings.TrimSpace(matcher))
+	}
+	return strings.Join(all, ", ")
+}
+
+// limit restricts the rate and the number of concurrent queries of the client.
+func (c *promClient) limit(p PrometheusOptions) {
+	if p.QueryRate > 0 {
+		c.limiter = rate.NewLimiter(rate.Limit(p.QueryRate), 1)
+	}
+	if p.MaxInFlight > 0 {
+		c.inFlight = make(chan struct{}, p.MaxInFlight)
+	}
+}
+
+// headerRoundTripper sets the headers to every request before passing it on.
+type headerRoundTripper struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range rt.headers {
+		req.Header[k] = v
+	}
+	return rt.next.RoundTrip(req)
+}
+
+func (p PrometheusOptions) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: p.InsecureSkipVerify, //nolint:gosec // explicitly requested by the user
+	}
+	if p.CAFile != "" {
+		ca, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prometheus ca file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in prometheus ca file %s", p.CAFile)
+		}
+	}
+	if p.CertFile != "" || p.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load prometheus client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (p PrometheusOptions) headers() (http.Header, error) {
+	headers := http.Header{}
+	for k, v := range p.Headers {
+		headers.Set(k, v)
+	}
+
+	if p.Tenant != "" {
+		headers.Set(tenantHeader, p.Tenant)
+	}
+
+	token := p.BearerToken
+	if p.BearerTokenFile != "" {
+		content, err := os.ReadFile(p.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prometheus bearer token file: %w", err)
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if token != "" && p.Username != "" {
+		return nil, fmt.Errorf("prometheus bearer token and basic auth can not be used together")
+	}
+	if token != "" {
+		headers.Set("Authorization", "Bearer "+token)
+	}
+	if p.Username != "" {
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(p.Username, p.Password)
+		headers.Set("Authorization", req.Header.Get("Authorization"))
+	}
+	return headers, nil
+}
+
+func makePrometheusClientForURL(p PrometheusOptions) (*promClient, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prometheus url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid prometheus url '%s', scheme must be http or https", p.URL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+
+	tlsConfig, err := p.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := p.headers()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+
+	return &promClient{
+		endpoint: u,
+		client: &http.Client{
+			Transport: &headerRoundTripper{headers: headers, next: transport},
+			Timeout:   p.Timeout,
+		},
+	}, nil
+}
@@ -0,0 +1,189 @@
+package advisor
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusOptionsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options PrometheusOptions
+		err     string
+	}{
+		{"defaults", PrometheusOptions{}, ""},
+		{"url with connection options", PrometheusOptions{
+			URL: "https://prometheus.example.com", BearerToken: "token", CAFile: "ca.pem", InsecureSkipVerify: true,
+			Headers: map[string]string{"X-Custom": "value"},
+		}, ""},
+		{"tenant and matchers without url", PrometheusOptions{Tenant: "team", Matchers: []string{`cluster="prod"`, ` env =~ "a|b" `}}, ""},
+		{"negative rate", PrometheusOptions{QueryRate: -1}, "prometheus query rate can not be negative"},
+		{"negative in-flight", PrometheusOptions{MaxInFlight: -1}, "prometheus max in-flight queries can not be negative"},
+		{"negative timeout", PrometheusOptions{Timeout: -time.Second}, "prometheus timeout can not be negative"},
+		{"invalid matcher", PrometheusOptions{Matchers: []string{"cluster=prod"}}, "invalid prometheus label matcher 'cluster=prod'"},
+		{"token without url", PrometheusOptions{BearerToken: "token"}, "--prometheus-token requires --prometheus-url"},
+		{"basic auth without url", PrometheusOptions{Username: "user", Password: "secret"}, "--prometheus-username requires --prometheus-url"},
+		{"client certificate without url", PrometheusOptions{CertFile: "cert.pem", KeyFile: "key.pem"}, "--prometheus-cert-file requires --prometheus-url"},
+		{"insecure without url", PrometheusOptions{InsecureSkipVerify: true}, "--prometheus-insecure-skip-verify requires --prometheus-url"},
+		{"header without url", PrometheusOptions{Headers: map[string]string{"X-Custom": "value"}}, "--prometheus-header requires --prometheus-url"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.options.validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestPrometheusHeaders(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		options  PrometheusOptions
+		expected map[string]string
+		err      string
+	}{
+		{"bearer token", PrometheusOptions{BearerToken: "token"}, map[string]string{"Authorization": "Bearer token"}, ""},
+		{"bearer token file", PrometheusOptions{BearerToken: "token", BearerTokenFile: tokenFile}, map[string]string{"Authorization": "Bearer file-token"}, ""},
+		{"basic auth", PrometheusOptions{Username: "user", Password: "secret"}, map[string]string{"Authorization": "Basic dXNlcjpzZWNyZXQ="}, ""},
+		{"tenant and headers", PrometheusOptions{Tenant: "team", Headers: map[string]string{"x-custom": "value"}}, map[string]string{
+			"X-Scope-Orgid": "team",
+			"X-Custom":      "value",
+		}, ""},
+		{"bearer token and basic auth", PrometheusOptions{BearerToken: "token", Username: "user"}, nil, "prometheus bearer token and basic auth can not be used together"},
+		{"missing token file", PrometheusOptions{BearerTokenFile: filepath.Join(t.TempDir(), "missing")}, nil, "failed to read prometheus bearer token file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			headers, err := tc.options.headers()
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(headers) != len(tc.expected) {
+				t.Errorf("expected headers %v, got %v", tc.expected, headers)
+			}
+			for name, value := range tc.expected {
+				if actual := headers.Get(name); actual != value {
+					t.Errorf("expected header %s %q, got %q", name, value, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestPrometheusClientForURL(t *testing.T) {
+	var received http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.URL.Path != "/prometheus/api/v1/query" {
+			t.Errorf("expected the query api below the url path, got %s", r.URL.Path)
+		}
+		if r.Form.Get("query") == "slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	})
+	server := httptest.NewUnstartedServer(handler)
+	// the handshake errors of the unknown authority case are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		options PrometheusOptions
+		query   string
+		err     string
+	}{
+		{"ca file", PrometheusOptions{URL: server.URL + "/prometheus/", CAFile: caFile, Tenant: "team", BearerToken: "token"}, "up", ""},
+		{"insecure", PrometheusOptions{URL: server.URL + "/prometheus", InsecureSkipVerify: true}, "up", ""},
+		{"unknown authority", PrometheusOptions{URL: server.URL + "/prometheus"}, "up", "certificate signed by unknown authority"},
+		{"timeout", PrometheusOptions{URL: server.URL + "/prometheus", CAFile: caFile, Timeout: 50 * time.Millisecond}, "slow", "Client.Timeout exceeded"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			received = nil
+			client, err := makePrometheusClientForURL(tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = queryPrometheus(context.Background(), client, tc.query, time.Now())
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.options.Tenant != "" && received.Get(tenantHeader) != tc.options.Tenant {
+				t.Errorf("expected tenant %s, got headers %v", tc.options.Tenant, received)
+			}
+			if tc.options.BearerToken != "" && received.Get("Authorization") != "Bearer "+tc.options.BearerToken {
+				t.Errorf("expected bearer token, got headers %v", received)
+			}
+		})
+	}
+
+	for _, url := range []string{"prometheus.example.com", "ftp://prometheus.example.com"} {
+		if _, err := makePrometheusClientForURL(PrometheusOptions{URL: url}); err == nil || !strings.Contains(err.Error(), "scheme must be http or https") {
+			t.Errorf("%s: expected invalid scheme, got %v", url, err)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		matchers []string
+		extra    []string
+		expected string
+	}{
+		{"no extra matchers", []string{`namespace="ns"`}, nil, `namespace="ns"`},
+		{"extra matchers", []string{`namespace="ns"`, `container!=""`}, []string{` cluster="prod" `, `env=~"a|b"`}, `namespace="ns", container!="", cluster="prod", env=~"a|b"`},
+		{"only extra matchers", nil, []string{`cluster="prod"`}, `cluster="prod"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{Prometheus: PrometheusOptions{Matchers: tc.extra}}
+			if actual := o.selector(tc.matchers...); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
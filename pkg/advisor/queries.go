@@ -0,0 +1,204 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// matchAll is used as the value of placeholders which do not select anything specific.
+const matchAll = ".+"
+
+// placeholderPattern matches a placeholder such as $namespace in a query template.
+var placeholderPattern = regexp.MustCompile(`\$([a-zA-Z_]+)`)
+
+// labelMatcherPattern matches a label matcher such as pod=~"$pod" in a query template.
+var labelMatcherPattern = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*"((?:[^"\\]|\\.)*)"`)
+
+// QueryTemplates contains user-defined PromQL templates replacing the built-in queries. Empty
+// templates keep the built-in query. The templates can contain the placeholders $namespace, $pod,
+// $container, $quantile, $window and $selector.
+type QueryTemplates struct {
+	CPURequest    string `json:"cpuRequest,omitempty"`    // cores
+	CPULimit      string `json:"cpuLimit,omitempty"`      // cores, multiplied by the limit margin
+	MemoryRequest string `json:"memoryRequest,omitempty"` // mebibytes
+	MemoryLimit   string `json:"memoryLimit,omitempty"`   // mebibytes, multiplied by the limit margin
+	Detect        string `json:"detect,omitempty"`        // returns any sample when the metrics exist
+}
+
+// queryValues contains the values of the placeholders of query templates.
+type queryValues struct {
+	Namespace string
+	Quantile  string
+	Window    string
+	Selector  string
+}
+
+func loadQueryTemplates(file string) (QueryTemplates, error) {
+	templates := QueryTemplates{}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return templates, fmt.Errorf("failed to read query config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(content, &templates); err != nil {
+		return templates, fmt.Errorf("failed to parse query config %s: %w", file, err)
+	}
+	return templates, nil
+}
+
+// queryTemplate is a query template with the name of its field in the query config.
+type queryTemplate struct {
+	name  string
+	query string
+}
+
+func (q QueryTemplates) templates() []queryTemplate {
+	return []queryTemplate{
+		{"cpuRequest", q.CPURequest},
+		{"cpuLimit", q.CPULimit},
+		{"memoryRequest", q.MemoryRequest},
+		{"memoryLimit", q.MemoryLimit},
+		{"detect", q.Detect},
+	}
+}
+
+func (q QueryTemplates) validate() error {
+	for _, template := range q.templates() {
+		if template.query != "" && strings.TrimSpace(template.query) == "" {
+			return fmt.Errorf("query template %s is empty", template.name)
+		}
+		for _, match := range placeholderPattern.FindAllStringSubmatch(template.query, -1) {
+			switch match[1] {
+			case "namespace", "pod", "container", "quantile", "window", "selector":
+			case "margin":
+				return fmt.Errorf("query template %s uses $margin, the limit margin is applied by the recommender to the result of the query", template.name)
+			default:
+				return fmt.Errorf("unknown placeholder %s in query template %s", match[0], template.name)
+			}
+		}
+		// the placeholders are replaced by regular expressions such as .+ which never equal a label
+		for _, match := range labelMatcherPattern.FindAllStringSubmatch(template.query, -1) {
+			regexOperator, ok := map[string]string{"=": "=~", "!=": "!~"}[match[2]]
+			if !ok {
+				continue
+			}
+			for _, placeholder := range []string{"$namespace", "$pod", "$container"} {
+				if strings.Contains(match[3], placeholder) {
+					return fmt.Errorf("query template %s matches %s with %s, use %s instead as %s is replaced by a regular expression",
+						template.name, match[0], match[2], regexOperator, placeholder)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkQueryTemplates evaluates the templates expanded for the namespace once to report syntax
+// errors at startup instead of in the middle of the analysis. At most one series is returned.
+func (o *Options) checkQueryTemplates(ctx context.Context, namespace string) error {
+	values := queryValues{
+		Namespace: namespace,
+		Quantile:  o.Quantile,
+		Window:    o.Window,
+		Selector:  o.selector(fmt.Sprintf(`namespace="%s"`, namespace), `container!=""`),
+	}
+	promcli := promv1.NewAPI(o.promClient)
+	for _, template := range o.Queries.templates() {
+		if template.query == "" {
+			continue
+		}
+		if _, _, err := promcli.Query(ctx, values.expand(template.query), o.at, promv1.WithLimit(1)); err != nil {
+			return fmt.Errorf("invalid query template %s: %w", template.name, err)
+		}
+	}
+	return nil
+}
+
+// cpuOverridden reports whether both cpu queries are user-defined such that the cpu mode is not
+// used at all.
+func (q QueryTemplates) cpuOverridden() bool {
+	return q.CPURequest != "" && q.CPULimit != ""
+}
+
+// expand replaces the placeholders of the template. Queries are evaluated once per namespace, so
+// pod and container match every pod and container.
+func (v queryValues) expand(template string) string {
+	return strings.NewReplacer(
+		"$namespace", v.Namespace,
+		"$pod", matchAll,
+		"$container", matchAll,
+		"$quantile", v.Quantile,
+		"$window", v.Window,
+		"$selector", v.Selector,
+	).Replace(template)
+}
+
+// namespaceQueries contains the usage queries of a namespace, see seriesMetrics.
+type namespaceQueries struct {
+	RequestCPU string
+	LimitCPU   string
+	RequestMem string
+	LimitMem   string
+	PeakCPU    string
+	PeakMem    string
+	Throttled  string
+	OOMKilled  string
+	Restarts   string
+}
+
+// namespaceQueries returns the usage queries of the namespace. The peaks of user-defined request
+// templates are queried with quantile 1. The limit queries are set only for user-defined limit
+// templates, otherwise the limits are based on the peak usage.
+func (o *Options) namespaceQueries(namespace string) namespaceQueries {
+	selector := o.selector(fmt.Sprintf(`namespace="%s"`, namespace), `container!=""`)
+	queries := namespaceQueries{
+		RequestCPU: fmt.Sprintf(podCPURequest, o.Quantile, o.cpuUsageRange(selector)),
+		RequestMem: fmt.Sprintf(podMemoryRequest, o.Quantile, selector, o.Window),
+		PeakCPU:    fmt.Sprintf(podCPUPeak, o.cpuUsageRange(selector)),
+		PeakMem:    fmt.Sprintf(podMemoryPeak, selector, o.Window),
+		Throttled:  fmt.Sprintf(podCPUThrottled, selector, o.Window, selector, o.Window),
+		OOMKilled:  fmt.Sprintf(podOOMKilled, selector, o.Window, selector, o.Window),
+		Restarts:   fmt.Sprintf(podRestarts, selector, o.Window),
+	}
+
+	values := queryValues{
+		Namespace: namespace,
+		Quantile:  o.Quantile,
+		Window:    o.Window,
+		Selector:  selector,
+	}
+	peak := values
+	peak.Quantile = "1"
+	if o.Queries.CPURequest != "" {
+		queries.RequestCPU = values.expand(o.Queries.CPURequest)
+		queries.PeakCPU = peak.expand(o.Queries.CPURequest)
+	}
+	if o.Queries.CPULimit != "" {
+		queries.LimitCPU = values.expand(o.Queries.CPULimit)
+	}
+	if o.Queries.MemoryRequest != "" {
+		queries.RequestMem = values.expand(o.Queries.MemoryRequest)
+		queries.PeakMem = peak.expand(o.Queries.MemoryRequest)
+	}
+	if o.Queries.MemoryLimit != "" {
+		queries.LimitMem = values.expand(o.Queries.MemoryLimit)
+	}
+	return queries
+}
+
+// detectQuery returns the user-defined detection query. It is evaluated for the whole cluster, so
+// namespace matches every namespace.
+func (o *Options) detectQuery() string {
+	values := queryValues{
+		Namespace: matchAll,
+		Quantile:  o.Quantile,
+		Window:    o.Window,
+		Selector:  o.selector(),
+	}
+	return values.expand(o.Queries.Detect)
+}
@@ -0,0 +1,231 @@
+package advisor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueryTemplatesValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		templates QueryTemplates
+		err       string
+	}{
+		{"none", QueryTemplates{}, ""},
+		{"regular expression matchers", QueryTemplates{
+			CPURequest: `quantile_over_time($quantile, cpu{namespace=~"$namespace", pod=~"$pod", container=~"$container"}[$window])`,
+			Detect:     `cpu{namespace!~"$namespace", job="cadvisor"}`,
+		}, ""},
+		{"fixed equality matcher", QueryTemplates{MemoryLimit: `max_over_time(rss{$selector, job="exporter"}[$window])`}, ""},
+		{"margin", QueryTemplates{CPULimit: `max_over_time(cpu{$selector}[$window]) * $margin`},
+			"query template cpuLimit uses $margin, the limit margin is applied by the recommender"},
+		{"unknown placeholder", QueryTemplates{CPULimit: `cpu{pod=~"$pods"}`}, "unknown placeholder $pods in query template cpuLimit"},
+		{"empty", QueryTemplates{CPULimit: "  "}, "query template cpuLimit is empty"},
+		{"pod equality", QueryTemplates{CPURequest: `cpu{pod="$pod"}`},
+			`query template cpuRequest matches pod="$pod" with =, use =~ instead as $pod is replaced by a regular expression`},
+		{"container equality with spaces", QueryTemplates{MemoryRequest: `rss{container = "$container"}`},
+			`query template memoryRequest matches container = "$container" with =, use =~ instead`},
+		{"namespace inequality", QueryTemplates{Detect: `cpu{namespace!="$namespace"}`},
+			`query template detect matches namespace!="$namespace" with !=, use !~ instead`},
+		{"placeholder inside the value", QueryTemplates{CPULimit: `cpu{pod="web-$pod"}`}, "use =~ instead as $pod"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.templates.validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestCheckQueryTemplates(t *testing.T) {
+	var mu sync.Mutex
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		query := r.Form.Get("query")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+		if r.Form.Get("limit") != "1" {
+			t.Errorf("expected limit 1, got %q", r.Form.Get("limit"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Count(query, "(") != strings.Count(query, ")") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"1:10: parse error: unclosed left parenthesis"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tc := range []struct {
+		name      string
+		templates QueryTemplates
+		expanded  []string
+		err       string
+	}{
+		{"expanded", QueryTemplates{
+			CPURequest:  `quantile_over_time($quantile, cpu{$selector, pod=~"$pod"}[$window])`,
+			MemoryLimit: `max_over_time(rss{namespace=~"$namespace", container=~"$container"}[$window])`,
+		}, []string{
+			`quantile_over_time(0.95, cpu{namespace="ns", container!="", pod=~".+"}[1w])`,
+			`max_over_time(rss{namespace=~"ns", container=~".+"}[1w])`,
+		}, ""},
+		{"parse error", QueryTemplates{CPULimit: `max(max_over_time(cpu{$selector}[$window])`}, nil,
+			"invalid query template cpuLimit: bad_data: 1:10: parse error: unclosed left parenthesis"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			queries = []string{}
+			o := &Options{Queries: tc.templates, Prometheus: PrometheusOptions{URL: server.URL}}
+			o.loadDefaults()
+			client, err := makePrometheusClientForURL(o.Prometheus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.promClient, o.at = client, time.Now()
+			err = o.checkQueryTemplates(context.Background(), "ns")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(queries, "\n") != strings.Join(tc.expanded, "\n") {
+				t.Errorf("expected queries\n%s\ngot\n%s", strings.Join(tc.expanded, "\n"), strings.Join(queries, "\n"))
+			}
+		})
+	}
+}
+
+func TestNamespaceQueriesMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode    string
+		request string
+		peak    string
+	}{
+		{ModeSumIrate,
+			`quantile_over_time(0.95, node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace="ns", container!=""}[1w])`,
+			`max_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace="ns", container!=""}[1w])`},
+		{ModeSumRate,
+			`quantile_over_time(0.95, node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace="ns", container!=""}[1w])`,
+			`max_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace="ns", container!=""}[1w])`},
+		{ModeRaw,
+			`quantile_over_time(0.95, (sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{namespace="ns", container!="", image!=""}[5m])))[1w:1m])`,
+			`max_over_time((sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{namespace="ns", container!="", image!=""}[5m])))[1w:1m])`},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			o := &Options{mode: tc.mode}
+			o.loadDefaults()
+			queries := o.namespaceQueries("ns")
+			for _, query := range []struct {
+				name     string
+				actual   string
+				expected string
+			}{
+				{"request", queries.RequestCPU, tc.request},
+				{"peak", queries.PeakCPU, tc.peak},
+			} {
+				if query.actual != query.expected {
+					t.Errorf("%s: expected\n%s\ngot\n%s", query.name, query.expected, query.actual)
+				}
+			}
+		})
+	}
+}
+
+func TestQuerySamplesMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		expected string
+	}{
+		{ModeSumIrate, `max by (namespace, pod, container) (node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace="ns", container!=""})`},
+		{ModeRaw, `max by (namespace, pod, container) (sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{namespace="ns", container!="", image!=""}[5m])))`},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			var mu sync.Mutex
+			queries := []string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				mu.Lock()
+				queries = append(queries, r.Form.Get("query"))
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+			}))
+			t.Cleanup(server.Close)
+
+			o := &Options{mode: tc.mode, Prometheus: PrometheusOptions{URL: server.URL}}
+			o.loadDefaults()
+			client, err := makePrometheusClientForURL(o.Prometheus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.promClient, o.at = client, time.Now()
+			if _, err := o.querySamples(context.Background(), "ns"); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Contains(queries, tc.expected) {
+				t.Errorf("expected cpu query\n%s\ngot\n%s", tc.expected, strings.Join(queries, "\n"))
+			}
+		})
+	}
+}
+
+func TestDetectModeCustom(t *testing.T) {
+	cpuRequest := `quantile_over_time($quantile, my_cpu{$selector}[$window])`
+	cpuLimit := `max_over_time(my_cpu{$selector}[$window])`
+	detect := `count(last_over_time(my_cpu{$selector}[$window]))`
+	for _, tc := range []struct {
+		name      string
+		templates QueryTemplates
+		data      []string
+		mode      string
+		err       string
+	}{
+		{"cpu queries", QueryTemplates{CPURequest: cpuRequest, CPULimit: cpuLimit}, nil, ModeCustom, ""},
+		{"cpu queries and detect", QueryTemplates{CPURequest: cpuRequest, CPULimit: cpuLimit, Detect: detect}, []string{"my_cpu"}, ModeCustom, ""},
+		// the built-in cpu limit query needs the detected mode
+		{"partial cpu override", QueryTemplates{CPURequest: cpuRequest, Detect: detect}, []string{"my_cpu", "sum_rate"}, ModeSumRate, ""},
+		{"memory override", QueryTemplates{MemoryRequest: `quantile_over_time($quantile, rss{$selector}[$window])`}, []string{"sum_irate"}, ModeSumIrate, ""},
+		{"detect without data", QueryTemplates{CPURequest: cpuRequest, CPULimit: cpuLimit, Detect: detect}, []string{"sum_irate"}, "", "custom detection query returned no data"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{Queries: tc.templates, usedNamespaces: "ns"}
+			queryServer(t, o, withData(tc.data...))
+			mode, err := o.detectMode(context.Background())
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode != tc.mode {
+				t.Errorf("expected mode %s, got %s", tc.mode, mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Recommendation strategies.
+const (
+	StrategyQuantile  = "quantile"  // usage at the quantile and peak usage with the limit margin
+	StrategyHistogram = "histogram" // percentile of usage samples weighted by their age
+	StrategyCustom    = "custom"    // Options.Recommender set by a library user
+)
+
+// Recommender turns the usage of a workload into recommended resources. Options.Strategy selects a
+// built-in implementation when Options.Recommender is not set. Implementations must be safe for
+// concurrent use as namespaces are analyzed in parallel.
+type Recommender interface {
+	// Recommend returns the recommended resources of the containers of the workload by container
+	// name. Containers left out are recommended zero resources. The values are rounded by the
+	// rounding policy afterwards.
+	Recommend(ctx context.Context, workload Workload, usage Usage) (map[string]ContainerResources, error)
+}
+
+// SampleRecommender is implemented by recommenders which use the usage samples of Usage.Samples.
+// The samples are fetched only when NeedsSamples returns true, and the metrics source must then
+// implement SampleSource.
+type SampleRecommender interface {
+	Recommender
+	NeedsSamples() bool
+}
+
+// ContainerResources contains the recommended resources of a container, cpu in cores and memory in
+// mebibytes.
+type ContainerResources struct {
+	RequestCPU float64
+	RequestMem float64
+	LimitCPU   float64
+	LimitMem   float64
+	Risk       []string // set by the advisor, see the Risk constants
+}
+
+// newRecommender returns the built-in recommender of the strategy.
+func (o *Options) newRecommender() (Recommender, error) {
+	if o.Recommender != nil {
+		return o.Recommender, nil
+	}
+	margin, err := strconv.ParseFloat(o.LimitMargin, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid limit margin '%s': %w", o.LimitMargin, err)
+	}
+	switch o.Strategy {
+	case StrategyQuantile:
+		return quantileRecommender{margin: margin}, nil
+	case StrategyHistogram:
+		if err := o.Histogram.validate(); err != nil {
+			return nil, err
+		}
+		return histogramRecommender{o: o, margin: margin}, nil
+	}
+	return nil, fmt.Errorf("unsupported strategy '%s', supported strategies are %s and %s", o.Strategy, StrategyQuantile, StrategyHistogram)
+}
+
+// strategy returns the name of the strategy in use.
+func (o *Options) strategy() string {
+	if o.Recommender != nil {
+		return StrategyCustom
+	}
+	return o.Strategy
+}
+
+// quantileRecommender requests the usage at the quantile and limits the peak usage multiplied by
+// the limit margin. Jobs and cronjobs request their peak usage
+// instead, as the usage of short-lived pods is dominated by a single burst of work.
+type quantileRecommender struct {
+	margin float64
+}
+
+func (q quantileRecommender) Recommend(_ context.Context, workload Workload, usage Usage) (map[string]ContainerResources, error) {
+	requestCPU, requestMem := usage.RequestCPU, usage.RequestMem
+	if isBatch(workload.Kind) {
+		requestCPU, requestMem = usage.PeakCPU, usage.PeakMem
+	}
+
+	resources := map[string]ContainerResources{}
+	for _, container := range usage.containers() {
+		resources[container] = ContainerResources{
+			RequestCPU: requestCPU[container],
+			RequestMem: requestMem[container],
+			LimitCPU:   usage.LimitCPU[container] * q.margin,
+			LimitMem:   usage.LimitMem[container] * q.margin,
+		}
+	}
+	return resources, nil
+}
+
+// recommend returns the recommended resources of the workload raised for under-provisioned
+// containers and rounded by the rounding policy. The usage samples are fetched only for
+// recommenders which need them.
+func (o *Options) recommend(ctx context.Context, metrics MetricsSource, workload Workload) (map[string]ContainerResources, error) {
+	usage, err := metrics.WorkloadUsage(ctx, workload)
+	if err != nil {
+		return nil, err
+	}
+	if recommender, ok := o.recommender.(SampleRecommender); ok && recommender.NeedsSamples() {
+		source, ok := metrics.(SampleSource)
+		if !ok {
+			return nil, fmt.Errorf("strategy %s requires usage samples which the metrics source does not provide", o.strategy())
+		}
+		samples, err := source.WorkloadSamples(ctx, workload)
+		if err != nil {
+			return nil, err
+		}
+		usage.Samples = &samples
+	}
+	resources, err := o.recommender.Recommend(ctx, workload, usage)
+	if err != nil {
+		return nil, err
+	}
+	return o.rounding.apply(workload.Namespace, o.Risk.apply(usage, resources)), nil
+}
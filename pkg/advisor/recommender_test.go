@@ -0,0 +1,154 @@
+package advisor
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// fakeSampleSource returns fixed usage and samples of every workload.
+type fakeSampleSource struct {
+	fakeSource
+	samples map[Workload]Samples
+}
+
+func (f fakeSampleSource) WorkloadSamples(_ context.Context, workload Workload) (Samples, error) {
+	return f.samples[workload], nil
+}
+
+// lastSample recommends the last cpu and memory sample of every container.
+type lastSample struct {
+	needsSamples bool
+}
+
+func (l lastSample) NeedsSamples() bool {
+	return l.needsSamples
+}
+
+func (lastSample) Recommend(_ context.Context, _ Workload, usage Usage) (map[string]ContainerResources, error) {
+	resources := map[string]ContainerResources{}
+	if usage.Samples == nil {
+		return resources, nil
+	}
+	for container, samples := range usage.Samples.CPU {
+		memory := usage.Samples.Memory[container]
+		resources[container] = ContainerResources{
+			RequestCPU: samples[len(samples)-1].Value,
+			RequestMem: memory[len(memory)-1].Value,
+		}
+	}
+	return resources, nil
+}
+
+func TestSampleRecommender(t *testing.T) {
+	samples := Samples{
+		CPU:    map[string][]Sample{"app": {{Value: 2}, {Value: 0.3}}},
+		Memory: map[string][]Sample{"app": {{Value: 1000}, {Value: 200}}},
+	}
+	source := fakeSampleSource{fakeSource: fakeSource{web: webUsage()}, samples: map[Workload]Samples{web: samples}}
+
+	for _, tc := range []struct {
+		name   string
+		source MetricsSource
+		needs  bool
+		cpu    string
+		memory string
+		err    string
+	}{
+		{name: "samples", source: source, needs: true, cpu: "300m", memory: "200Mi"},
+		{name: "samples not needed", source: source, needs: false},
+		{name: "source without samples", source: fakeSource{web: webUsage()}, needs: true, err: "strategy custom requires usage samples"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{Recommender: lastSample{needsSamples: tc.needs}}
+			o.loadDefaults()
+			o.recommender = o.Recommender
+			rounding, err := o.Rounding.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.rounding = rounding
+			resources, err := o.recommend(context.Background(), tc.source, web)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.cpu == "" {
+				if len(resources) != 0 {
+					t.Errorf("expected no samples, got %v", resources)
+				}
+				return
+			}
+			requests := v1.ResourceList{
+				v1.ResourceCPU:    cpuQuantity(resources["app"].RequestCPU),
+				v1.ResourceMemory: memoryQuantity(resources["app"].RequestMem),
+			}
+			assertQuantity(t, "app", requests, v1.ResourceCPU, tc.cpu)
+			assertQuantity(t, "app", requests, v1.ResourceMemory, tc.memory)
+		})
+	}
+}
+
+func TestQuantileRecommender(t *testing.T) {
+	usage := Usage{
+		RequestCPU: map[string]float64{"app": 0.2},
+		RequestMem: map[string]float64{"app": 300},
+		LimitCPU:   map[string]float64{"app": 0.5},
+		LimitMem:   map[string]float64{"app": 500},
+		PeakCPU:    map[string]float64{"app": 0.4},
+		PeakMem:    map[string]float64{"app": 400},
+	}
+	for _, tc := range []struct {
+		name     string
+		margin   string
+		kind     string
+		expected ContainerResources
+		err      string
+	}{
+		{name: "default margin", kind: KindDeployment, expected: ContainerResources{RequestCPU: 0.2, RequestMem: 300, LimitCPU: 0.6, LimitMem: 600}},
+		{name: "margin", margin: "2", kind: KindDeployment, expected: ContainerResources{RequestCPU: 0.2, RequestMem: 300, LimitCPU: 1, LimitMem: 1000}},
+		{name: "job requests the peak", kind: KindJob, expected: ContainerResources{RequestCPU: 0.4, RequestMem: 400, LimitCPU: 0.6, LimitMem: 600}},
+		{name: "invalid margin", margin: "high", kind: KindDeployment, err: "invalid limit margin 'high'"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{LimitMargin: tc.margin}
+			o.loadDefaults()
+			recommender, err := o.newRecommender()
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resources, err := recommender.Recommend(context.Background(), Workload{Kind: tc.kind}, usage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := resources["app"]
+			for _, value := range []struct {
+				name             string
+				actual, expected float64
+			}{
+				{"cpu request", actual.RequestCPU, tc.expected.RequestCPU},
+				{"memory request", actual.RequestMem, tc.expected.RequestMem},
+				{"cpu limit", actual.LimitCPU, tc.expected.LimitCPU},
+				{"memory limit", actual.LimitMem, tc.expected.LimitMem},
+			} {
+				if math.Abs(value.actual-value.expected) > 1e-9 {
+					t.Errorf("%s: expected %g, got %g", value.name, value.expected, value.actual)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// RecordingVersion is the format version of recordings. Recordings of other versions can not be
+// replayed.
+const RecordingVersion = "v2"
+
+// Files of a recording directory.
+const (
+	recordingRunFile       = "run.json"
+	recordingWorkloadsFile = "workloads.json"
+	recordingSamplesFile   = "samples.json"
+)
+
+// recordedRun contains the settings and the detected metrics of a recorded run. The quantile and
+// the limit margin are not recorded as they are applied to the samples when replaying.
+type recordedRun struct {
+	Version        string        `json:"version"`
+	Namespaces     []string      `json:"namespaces"`
+	Window         string        `json:"window"`
+	SampleDuration time.Duration `json:"sampleDuration"`
+	At             time.Time     `json:"at"`
+	Mode           string        `json:"mode"`
+	History        string        `json:"history"`
+}
+
+// recordedWorkloads contains the workloads of the recorded namespaces stripped down to the fields
+// used by the analysis.
+type recordedWorkloads struct {
+	Deployments  []appsv1.Deployment  `json:"deployments"`
+	StatefulSets []appsv1.StatefulSet `json:"statefulSets"`
+	DaemonSets   []appsv1.DaemonSet   `json:"daemonSets"`
+	CronJobs     []batchv1.CronJob    `json:"cronJobs"`
+	Jobs         []batchv1.Job        `json:"jobs"`
+}
+
+// recordedContainer contains the samples of a single container and the workload of its pod.
+type recordedContainer struct {
+	Workload  Workload `json:"workload"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	containerSamples
+}
+
+func (o *Options) validateRecording() error {
+	if o.Record != "" && o.Replay != "" {
+		return fmt.Errorf("record and replay can not be used together")
+	}
+	if o.Record != "" && (o.Queries.CPURequest != "" || o.Queries.CPULimit != "" || o.Queries.MemoryRequest != "" || o.Queries.MemoryLimit != "") {
+		return fmt.Errorf("query templates can not be used with --record, the recording contains the usage samples")
+	}
+	return nil
+}
+
+// stripMeta keeps only the identity and the owners of the object.
+func stripMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: meta.Name, Namespace: meta.Namespace, OwnerReferences: meta.OwnerReferences}
+}
+
+// stripPodTemplate keeps only the names, types and resources of the containers. Environment
+// variables, commands and the rest of the pod spec may contain secrets.
+func stripPodTemplate(template v1.PodTemplateSpec) v1.PodTemplateSpec {
+	strip := func(containers []v1.Container) []v1.Container {
+		stripped := []v1.Container{}
+		for _, container := range containers {
+			stripped = append(stripped, v1.Container{
+				Name:          container.Name,
+				Resources:     container.Resources,
+				RestartPolicy: container.RestartPolicy,
+			})
+		}
+		return stripped
+	}
+	return v1.PodTemplateSpec{Spec: v1.PodSpec{
+		InitContainers: strip(template.Spec.InitContainers),
+		Containers:     strip(template.Spec.Containers),
+	}}
+}
+
+// recordWorkloads lists the workloads of the namespaces. They are listed separately from the
+// analysis which may see slightly different workloads if they change in between.
+func (o *Options) recordWorkloads(ctx context.Context, namespaces []string) (*recordedWorkloads, error) {
+	workloads := &recordedWorkloads{}
+	for _, namespace := range namespaces {
+		deployments, err := o.Client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, deployment := range deployments.Items {
+			workloads.Deployments = append(workloads.Deployments, appsv1.Deployment{
+				ObjectMeta: stripMeta(deployment.ObjectMeta),
+				Spec:       appsv1.DeploymentSpec{Replicas: deployment.Spec.Replicas, Template: stripPodTemplate(deployment.Spec.Template)},
+			})
+		}
+
+		statefulSets, err := o.Client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, statefulSet := range statefulSets.Items {
+			workloads.StatefulSets = append(workloads.StatefulSets, appsv1.StatefulSet{
+				ObjectMeta: stripMeta(statefulSet.ObjectMeta),
+				Spec:       appsv1.StatefulSetSpec{Replicas: statefulSet.Spec.Replicas, Template: stripPodTemplate(statefulSet.Spec.Template)},
+			})
+		}
+
+		daemonSets, err := o.Client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, daemonSet := range daemonSets.Items {
+			workloads.DaemonSets = append(workloads.DaemonSets, appsv1.DaemonSet{
+				ObjectMeta: stripMeta(daemonSet.ObjectMeta),
+				Spec:       appsv1.DaemonSetSpec{Template: stripPodTemplate(daemonSet.Spec.Template)},
+				Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: daemonSet.Status.DesiredNumberScheduled},
+			})
+		}
+
+		cronJobs, err := o.Client.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, cronJob := range cronJobs.Items {
+			workloads.CronJobs = append(workloads.CronJobs, batchv1.CronJob{
+				ObjectMeta: stripMeta(cronJob.ObjectMeta),
+				Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+					Parallelism: cronJob.Spec.JobTemplate.Spec.Parallelism,
+					Template:    stripPodTemplate(cronJob.Spec.JobTemplate.Spec.Template),
+				}}},
+			})
+		}
+
+		jobs, err := o.Client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs.Items {
+			workloads.Jobs = append(workloads.Jobs, batchv1.Job{
+				ObjectMeta: stripMeta(job.ObjectMeta),
+				Spec:       batchv1.JobSpec{Parallelism: job.Spec.Parallelism, Template: stripPodTemplate(job.Spec.Template)},
+			})
+		}
+	}
+	return workloads, nil
+}
+
+// recordSamples returns the usage samples of the workloads in the namespaces. The analysis of a
+// recorded run uses them instead of the metrics source such that the replay produces the same
+// output.
+func (o *Options) recordSamples(ctx context.Context, metrics MetricsSource, namespaces []string) (*sampledSource, error) {
+	switch source := metrics.(type) {
+	case *prometheusSource:
+		return source.sampled(ctx, namespaces)
+	case *metricsServerSource:
+		return source.sampledSource, nil
+	}
+	return nil, fmt.Errorf("usage of the metrics source can not be recorded")
+}
+
+// writeRecording writes the run, the workloads and the usage samples to the record directory.
+func (o *Options) writeRecording(namespaces []string, workloads *recordedWorkloads, source *sampledSource) error {
+	containers := make([]recordedContainer, 0, len(source.samples))
+	for k, samples := range source.samples {
+		containers = append(containers, recordedContainer{
+			Workload:         source.workloads[k.Namespace][k.Pod],
+			Pod:              k.Pod,
+			Container:        k.Container,
+			containerSamples: *samples,
+		})
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		a, b := containers[i], containers[j]
+		if a.Workload.Namespace != b.Workload.Namespace {
+			return a.Workload.Namespace < b.Workload.Namespace
+		}
+		if a.Pod != b.Pod {
+			return a.Pod < b.Pod
+		}
+		return a.Container < b.Container
+	})
+
+	run := recordedRun{
+		Version:        RecordingVersion,
+		Namespaces:     namespaces,
+		Window:         o.Window,
+		SampleDuration: o.SampleDuration,
+		At:             o.at,
+		Mode:           o.mode,
+		History:        o.history,
+	}
+
+	if err := os.MkdirAll(o.Record, 0o750); err != nil {
+		return fmt.Errorf("failed to create record directory: %w", err)
+	}
+	for name, content := range map[string]interface{}{
+		recordingRunFile:       run,
+		recordingWorkloadsFile: workloads,
+		recordingSamplesFile:   containers,
+	} {
+		out, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(o.Record, name), out, 0o600); err != nil {
+			return fmt.Errorf("failed to write recording: %w", err)
+		}
+	}
+	return nil
+}
+
+func readRecordingFile(dir string, name string, content interface{}) error {
+	in, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	if err := json.Unmarshal(in, content); err != nil {
+		return fmt.Errorf("failed to parse %s of recording: %w", name, err)
+	}
+	return nil
+}
+
+// loadRecording restores the settings of the recorded run and returns the recorded samples. The
+// client is replaced with a fake one serving the recorded workloads. The usage covers only the
+// recorded window, so a different --window or --at is an error.
+func (o *Options) loadRecording() (*sampledSource, error) {
+	run := recordedRun{}
+	if err := readRecordingFile(o.Replay, recordingRunFile, &run); err != nil {
+		return nil, err
+	}
+	if run.Version != RecordingVersion {
+		return nil, fmt.Errorf("unsupported recording version '%s', supported version is %s", run.Version, RecordingVersion)
+	}
+	if !o.defaultWindow && o.Window != run.Window {
+		return nil, fmt.Errorf("--window %s differs from the recorded window %s", o.Window, run.Window)
+	}
+	if o.At != "" && !o.at.Equal(run.At) {
+		return nil, fmt.Errorf("--at %s differs from the recorded evaluation time %s", o.At, run.At.Format(time.RFC3339))
+	}
+	workloads := recordedWorkloads{}
+	if err := readRecordingFile(o.Replay, recordingWorkloadsFile, &workloads); err != nil {
+		return nil, err
+	}
+	containers := []recordedContainer{}
+	if err := readRecordingFile(o.Replay, recordingSamplesFile, &containers); err != nil {
+		return nil, err
+	}
+
+	objects := []runtime.Object{}
+	for i := range workloads.Deployments {
+		objects = append(objects, &workloads.Deployments[i])
+	}
+	for i := range workloads.StatefulSets {
+		objects = append(objects, &workloads.StatefulSets[i])
+	}
+	for i := range workloads.DaemonSets {
+		objects = append(objects, &workloads.DaemonSets[i])
+	}
+	for i := range workloads.CronJobs {
+		objects = append(objects, &workloads.CronJobs[i])
+	}
+	for i := range workloads.Jobs {
+		objects = append(objects, &workloads.Jobs[i])
+	}
+	o.Client = fake.NewClientset(objects...)
+
+	o.usedNamespaces = strings.Join(run.Namespaces, ",")
+	o.Window = run.Window
+	o.SampleDuration = run.SampleDuration
+	o.at = run.At
+	o.mode = run.Mode
+	o.history = run.History
+
+	source := newSampledSource(o)
+	for _, container := range containers {
+		k := containerKey{Namespace: container.Workload.Namespace, Pod: container.Pod, Container: container.Container}
+		samples := container.containerSamples
+		source.samples[k] = &samples
+		if source.workloads[k.Namespace] == nil {
+			source.workloads[k.Namespace] = map[string]Workload{}
+		}
+		source.workloads[k.Namespace][k.Pod] = container.Workload
+	}
+	return source, nil
+}
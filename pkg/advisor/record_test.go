@@ -0,0 +1,134 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// recordingServer serves deployment web in namespace ns with ten cpu and memory samples of the app
+// container.
+func recordingServer(t *testing.T, at time.Time) *httptest.Server {
+	t.Helper()
+	values := func(step float64) string {
+		samples := []string{}
+		for i := 1; i <= 10; i++ {
+			samples = append(samples, fmt.Sprintf(`[%d,"%g"]`, at.Add(time.Duration(i-10)*sampleStep).Unix(), float64(i)*step))
+		}
+		return strings.Join(samples, ",")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		query := r.Form.Get("query")
+		resultType, result := "vector", "[]"
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/query_range"):
+			resultType = "matrix"
+			if strings.Contains(query, "sum_irate") {
+				result = `[{"metric":{"namespace":"ns","pod":"web-1-a","container":"app"},"values":[` + values(0.1) + `]}]`
+			} else if strings.Contains(query, "memory") {
+				result = `[{"metric":{"namespace":"ns","pod":"web-1-a","container":"app"},"values":[` + values(100) + `]}]`
+			}
+		case strings.HasPrefix(query, "count("):
+			result = `[{"metric":{},"value":[0,"1"]}]`
+		case strings.Contains(query, "kube_pod_owner"):
+			result = `[{"metric":{"namespace":"ns","pod":"web-1-a","owner_kind":"ReplicaSet","owner_name":"web-1"},"value":[0,"1"]}]`
+		case strings.Contains(query, "kube_replicaset_owner"):
+			result = `[{"metric":{"namespace":"ns","replicaset":"web-1","owner_kind":"Deployment","owner_name":"web"},"value":[0,"1"]}]`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"` + resultType + `","result":` + result + `}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRecordReplay(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := recordingServer(t, at)
+	dir := t.TempDir()
+
+	deployment := webDeployment()
+	deployment.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": `{"password":"hunter2"}`}
+	deployment.Spec.Template.Spec.Containers[0].Env = []v1.EnvVar{{Name: "PASSWORD", Value: "hunter2"}}
+	o := &Options{
+		Namespaces: "ns",
+		At:         at.Format(time.RFC3339),
+		Record:     dir,
+		Client:     fake.NewClientset(deployment),
+		Prometheus: PrometheusOptions{URL: server.URL},
+		Out:        io.Discard,
+	}
+	o.loadDefaults()
+	recorded, err := o.analyze(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertQuantity(t, "recorded", recommendationOf(t, recorded, "app").Recommended.Requests, v1.ResourceCPU, "1")
+
+	for _, name := range []string{recordingRunFile, recordingWorkloadsFile, recordingSamplesFile} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(content), "hunter2") {
+			t.Errorf("expected %s without secrets, got %s", name, content)
+		}
+	}
+
+	replay := func(o *Options) (*Response, error) {
+		o.Replay = dir
+		o.Out = io.Discard
+		o.loadDefaults()
+		return o.analyze(context.Background())
+	}
+
+	t.Run("same output", func(t *testing.T) {
+		replayed, err := replay(&Options{At: at.Format(time.RFC3339)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := json.Marshal(recorded)
+		actual, _ := json.Marshal(replayed)
+		if string(actual) != string(expected) {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+	})
+
+	t.Run("other quantile", func(t *testing.T) {
+		replayed, err := replay(&Options{Quantile: "0.5"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertQuantity(t, "replayed", recommendationOf(t, replayed, "app").Recommended.Requests, v1.ResourceCPU, "600m")
+	})
+
+	for _, tc := range []struct {
+		name    string
+		options Options
+		err     string
+	}{
+		{"other window", Options{Window: "2w"}, "--window 2w differs from the recorded window 1w"},
+		{"other evaluation time", Options{At: at.Add(time.Hour).Format(time.RFC3339)}, "differs from the recorded evaluation time"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := replay(&tc.options)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
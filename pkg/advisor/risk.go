@@ -0,0 +1,69 @@
+package advisor
+
+import (
+	"fmt"
+)
+
+// Reasons a container may be under-provisioned. Usage is capped by the current limits, so the
+// usage of these containers understates what they need.
+const (
+	RiskThrottled = "throttled"  // cpu throttled in more periods than the threshold
+	RiskOOMKilled = "oom-killed" // a pod was OOM killed and restarted during the window
+	RiskRestarts  = "restarts"   // a pod restarted during the window
+)
+
+const (
+	defaultThrottlingThreshold = 0.1
+	defaultRiskIncrease        = 1.5
+)
+
+// RiskOptions configures how under-provisioned containers are handled.
+type RiskOptions struct {
+	Throttling *float64 // fraction of throttled cpu periods above which cpu is raised, defaults to 0.1 when nil
+	Increase   float64  // multiplier of the raised recommendations, defaults to 1.5, 1 only flags them
+}
+
+func (r *RiskOptions) loadDefaults() {
+	if r.Throttling == nil {
+		threshold := defaultThrottlingThreshold
+		r.Throttling = &threshold
+	}
+	if r.Increase == 0 {
+		r.Increase = defaultRiskIncrease
+	}
+}
+
+func (r RiskOptions) validate() error {
+	if *r.Throttling < 0 || *r.Throttling > 1 {
+		return fmt.Errorf("throttling threshold must be between 0 and 1, got %g", *r.Throttling)
+	}
+	if r.Increase < 1 {
+		return fmt.Errorf("risk increase must be at least 1, got %g", r.Increase)
+	}
+	return nil
+}
+
+// apply flags the containers which were throttled, OOM killed or restarted and raises cpu of the
+// throttled and memory of the OOM killed containers. Restarts alone are only flagged as they have
+// many other causes.
+func (r RiskOptions) apply(usage Usage, resources map[string]ContainerResources) map[string]ContainerResources {
+	raised := make(map[string]ContainerResources, len(resources))
+	for container, res := range resources {
+		res.Risk = nil
+		if usage.Throttled[container] > *r.Throttling {
+			res.Risk = append(res.Risk, RiskThrottled)
+			res.RequestCPU *= r.Increase
+			res.LimitCPU *= r.Increase
+		}
+		if usage.OOMKilled[container] > 0 {
+			res.Risk = append(res.Risk, RiskOOMKilled)
+			res.RequestMem *= r.Increase
+			res.LimitMem *= r.Increase
+		}
+		if usage.Restarts[container] >= 1 {
+			res.Risk = append(res.Risk, RiskRestarts)
+		}
+		raised[container] = res
+	}
+	return raised
+}
@@ -0,0 +1,111 @@
+package advisor
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRiskThrottlingThreshold(t *testing.T) {
+	zero, half := 0.0, 0.5
+	for _, tc := range []struct {
+		name      string
+		threshold *float64
+		throttled float64
+		risk      []string
+	}{
+		{"default", nil, 0.05, nil},
+		{"default exceeded", nil, 0.2, []string{RiskThrottled}},
+		{"zero flags any throttling", &zero, 0.01, []string{RiskThrottled}},
+		{"zero without throttling", &zero, 0, nil},
+		{"half", &half, 0.2, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := RiskOptions{Throttling: tc.threshold}
+			r.loadDefaults()
+			if err := r.validate(); err != nil {
+				t.Fatal(err)
+			}
+			usage := Usage{Throttled: map[string]float64{"app": tc.throttled}}
+			raised := r.apply(usage, map[string]ContainerResources{"app": {RequestCPU: 1}})
+			if !reflect.DeepEqual(raised["app"].Risk, tc.risk) {
+				t.Errorf("expected risk %v, got %v", tc.risk, raised["app"].Risk)
+			}
+		})
+	}
+}
+
+func TestRiskApply(t *testing.T) {
+	resources := func() map[string]ContainerResources {
+		return map[string]ContainerResources{
+			"app":   {RequestCPU: 0.2, RequestMem: 300, LimitCPU: 0.4, LimitMem: 600},
+			"proxy": {RequestCPU: 0.1, RequestMem: 100, LimitCPU: 0.2, LimitMem: 200},
+		}
+	}
+	for _, tc := range []struct {
+		name     string
+		usage    Usage
+		risk     []string
+		expected ContainerResources
+	}{
+		{"no risk", Usage{}, nil, ContainerResources{RequestCPU: 0.2, RequestMem: 300, LimitCPU: 0.4, LimitMem: 600}},
+		{"throttled below threshold", Usage{Throttled: map[string]float64{"app": 0.05}}, nil,
+			ContainerResources{RequestCPU: 0.2, RequestMem: 300, LimitCPU: 0.4, LimitMem: 600}},
+		{"throttled", Usage{Throttled: map[string]float64{"app": 0.5}}, []string{RiskThrottled},
+			ContainerResources{RequestCPU: 0.3, RequestMem: 300, LimitCPU: 0.6, LimitMem: 600}},
+		{"oom killed", Usage{OOMKilled: map[string]float64{"app": 1}}, []string{RiskOOMKilled},
+			ContainerResources{RequestCPU: 0.2, RequestMem: 450, LimitCPU: 0.4, LimitMem: 900}},
+		{"restarts are only flagged", Usage{Restarts: map[string]float64{"app": 3}}, []string{RiskRestarts},
+			ContainerResources{RequestCPU: 0.2, RequestMem: 300, LimitCPU: 0.4, LimitMem: 600}},
+		{"all", Usage{
+			Throttled: map[string]float64{"app": 0.5},
+			OOMKilled: map[string]float64{"app": 1},
+			Restarts:  map[string]float64{"app": 1},
+		}, []string{RiskThrottled, RiskOOMKilled, RiskRestarts}, ContainerResources{RequestCPU: 0.3, RequestMem: 450, LimitCPU: 0.6, LimitMem: 900}},
+		{"other container", Usage{OOMKilled: map[string]float64{"proxy": 1}}, nil,
+			ContainerResources{RequestCPU: 0.2, RequestMem: 300, LimitCPU: 0.4, LimitMem: 600}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := RiskOptions{}
+			r.loadDefaults()
+			original := resources()
+			raised := r.apply(tc.usage, original)
+			actual := raised["app"]
+			// the increase is not exact in floating point
+			for _, value := range []struct {
+				name             string
+				actual, expected float64
+			}{
+				{"cpu request", actual.RequestCPU, tc.expected.RequestCPU},
+				{"memory request", actual.RequestMem, tc.expected.RequestMem},
+				{"cpu limit", actual.LimitCPU, tc.expected.LimitCPU},
+				{"memory limit", actual.LimitMem, tc.expected.LimitMem},
+			} {
+				if math.Abs(value.actual-value.expected) > 1e-6 {
+					t.Errorf("%s: expected %g, got %g", value.name, value.expected, value.actual)
+				}
+			}
+			if !reflect.DeepEqual(actual.Risk, tc.risk) {
+				t.Errorf("expected risk %v, got %v", tc.risk, actual.Risk)
+			}
+			if len(raised) != 2 {
+				t.Errorf("expected every container, got %v", raised)
+			}
+			if !reflect.DeepEqual(original, resources()) {
+				t.Errorf("expected the resources to be left unchanged, got %v", original)
+			}
+		})
+	}
+}
+
+func TestOOMKilledQueryRequiresRestart(t *testing.T) {
+	o := &Options{}
+	o.loadDefaults()
+	o.mode = ModeSumIrate
+	query := o.namespaceQueries("ns").OOMKilled
+	expected := `and on (namespace, pod, container) increase(kube_pod_container_status_restarts_total{namespace="ns", container!=""}[1w]) > 0`
+	if !strings.Contains(query, expected) {
+		t.Errorf("expected %s to contain %s", query, expected)
+	}
+}
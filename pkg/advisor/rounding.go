@@ -0,0 +1,218 @@
+package advisor
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// RoundingPolicy controls how recommendations are rounded and bounded. It is applied to the
+// requests and the limits of every strategy. Without a step cpu is rounded up to 0.1 cores, or to
+// 0.01 cores for very small values, and memory to 100Mi.
+type RoundingPolicy struct {
+	CPU       ResourceRounding   `json:"cpu,omitempty"`
+	Memory    ResourceRounding   `json:"memory,omitempty"`
+	Overrides []RoundingOverride `json:"overrides,omitempty"` // the first matching override is used
+}
+
+// ResourceRounding contains the rounding of a single resource as Kubernetes quantities such as 50m
+// or 64Mi. Empty values are not set.
+type ResourceRounding struct {
+	Step string `json:"step,omitempty"` // values are rounded up to a multiple of the step
+	Min  string `json:"min,omitempty"`
+	Max  string `json:"max,omitempty"`
+}
+
+// RoundingOverride replaces the rounding of containers matching the patterns. The patterns are
+// regular expressions matching the whole name, empty patterns match everything. Values not set in
+// the override are taken from the policy.
+type RoundingOverride struct {
+	Namespace string           `json:"namespace,omitempty"`
+	Container string           `json:"container,omitempty"`
+	CPU       ResourceRounding `json:"cpu,omitempty"`
+	Memory    ResourceRounding `json:"memory,omitempty"`
+}
+
+// rounding is a parsed ResourceRounding in cores or mebibytes. Zero values are not set.
+type rounding struct {
+	step float64
+	min  float64
+	max  float64
+}
+
+// roundingRule is a parsed RoundingOverride.
+type roundingRule struct {
+	namespace *regexp.Regexp
+	container *regexp.Regexp
+	cpu       rounding
+	memory    rounding
+}
+
+// roundingPolicy is a parsed RoundingPolicy.
+type roundingPolicy struct {
+	cpu       rounding
+	memory    rounding
+	overrides []roundingRule
+}
+
+func loadRoundingPolicy(file string) (RoundingPolicy, error) {
+	policy := RoundingPolicy{}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read rounding config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(content, &policy); err != nil {
+		return policy, fmt.Errorf("failed to parse rounding config %s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// cores converts a cpu quantity to cores.
+func cores(q resource.Quantity) float64 {
+	return q.AsApproximateFloat64()
+}
+
+// mebibytes converts a memory quantity to mebibytes.
+func mebibytes(q resource.Quantity) float64 {
+	return q.AsApproximateFloat64() / 1024 / 1024
+}
+
+// parse returns the rounding with the values not set taken from base.
+func (r ResourceRounding) parse(name string, unit func(resource.Quantity) float64, base rounding) (rounding, error) {
+	parsed := base
+	for _, field := range []struct {
+		name   string
+		value  string
+		target *float64
+	}{
+		{"step", r.Step, &parsed.step},
+		{"min", r.Min, &parsed.min},
+		{"max", r.Max, &parsed.max},
+	} {
+		if field.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(field.value)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid %s %s '%s': %w", name, field.name, field.value, err)
+		}
+		if q.Sign() <= 0 {
+			return parsed, fmt.Errorf("%s %s must be positive, got %s", name, field.name, field.value)
+		}
+		*field.target = unit(q)
+	}
+	if parsed.max > 0 && parsed.min > parsed.max {
+		return parsed, fmt.Errorf("%s min %g is greater than max %g", name, parsed.min, parsed.max)
+	}
+	return parsed, nil
+}
+
+// compilePattern returns a regular expression matching the whole name, or nil for an empty pattern.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	return re, nil
+}
+
+func (p RoundingPolicy) compile() (*roundingPolicy, error) {
+	var err error
+	policy := &roundingPolicy{}
+	policy.cpu, err = p.CPU.parse("cpu", cores, rounding{})
+	if err != nil {
+		return nil, err
+	}
+	policy.memory, err = p.Memory.parse("memory", mebibytes, rounding{})
+	if err != nil {
+		return nil, err
+	}
+	for i, override := range p.Overrides {
+		rule := roundingRule{}
+		if rule.namespace, err = compilePattern(override.Namespace); err != nil {
+			return nil, fmt.Errorf("override %d: %w", i+1, err)
+		}
+		if rule.container, err = compilePattern(override.Container); err != nil {
+			return nil, fmt.Errorf("override %d: %w", i+1, err)
+		}
+		if rule.cpu, err = override.CPU.parse("cpu", cores, policy.cpu); err != nil {
+			return nil, fmt.Errorf("override %d: %w", i+1, err)
+		}
+		if rule.memory, err = override.Memory.parse("memory", mebibytes, policy.memory); err != nil {
+			return nil, fmt.Errorf("override %d: %w", i+1, err)
+		}
+		policy.overrides = append(policy.overrides, rule)
+	}
+	return policy, nil
+}
+
+// rules returns the rounding of cpu and memory of a container.
+func (p *roundingPolicy) rules(namespace string, container string) (rounding, rounding) {
+	for _, rule := range p.overrides {
+		if rule.namespace != nil && !rule.namespace.MatchString(namespace) {
+			continue
+		}
+		if rule.container != nil && !rule.container.MatchString(container) {
+			continue
+		}
+		return rule.cpu, rule.memory
+	}
+	return p.cpu, p.memory
+}
+
+// apply rounds and bounds the recommended resources of the containers of a workload.
+func (p *roundingPolicy) apply(namespace string, resources map[string]ContainerResources) map[string]ContainerResources {
+	rounded := make(map[string]ContainerResources, len(resources))
+	for container, r := range resources {
+		cpu, memory := p.rules(namespace, container)
+		rounded[container] = ContainerResources{
+			RequestCPU: cpu.round(r.RequestCPU, roundCPU),
+			RequestMem: memory.round(r.RequestMem, roundMemory),
+			LimitCPU:   cpu.round(r.LimitCPU, roundCPU),
+			LimitMem:   memory.round(r.LimitMem, roundMemory),
+			Risk:       r.Risk,
+		}
+	}
+	return rounded
+}
+
+// round rounds the value up to the step, or with the default function without a step, and keeps
+// it within the bounds.
+func (r rounding) round(value float64, defaultRound func(float64) float64) float64 {
+	if r.step > 0 {
+		// the tolerance keeps exact multiples of the step from being rounded up by float errors and
+		// the result is rounded to a micro unit to get 0.3 instead of 0.30000000000000004
+		value = math.Round(math.Ceil(value/r.step-1e-9)*r.step*1e6) / 1e6
+	} else {
+		value = defaultRound(value)
+	}
+	if r.min > 0 && value < r.min {
+		value = r.min
+	}
+	if r.max > 0 && value > r.max {
+		value = r.max
+	}
+	return value
+}
+
+// roundCPU rounds up to 0.1 cores, or to 0.01 cores for very small values. Like with steps, float
+// errors of scaled values such as 0.2 * 1.5 do not round up to the next step.
+func roundCPU(value float64) float64 {
+	scale := 10
+	if value < 0.01 {
+		scale = 100
+	}
+	return math.Ceil(value*float64(scale)-1e-9) / float64(scale)
+}
+
+// roundMemory rounds up to 100Mi.
+func roundMemory(value float64) float64 {
+	return math.Ceil(value/100-1e-9) * 100
+}
@@ -0,0 +1,126 @@
+package advisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRound(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		rounding rounding
+		value    float64
+		round    func(float64) float64
+		expected float64
+	}{
+		{"default cpu", rounding{}, 0.21, roundCPU, 0.3},
+		{"default small cpu", rounding{}, 0.005, roundCPU, 0.01},
+		{"scaled cpu is not rounded up", rounding{}, 0.2 * 1.5, roundCPU, 0.3},
+		{"default memory", rounding{}, 201, roundMemory, 300},
+		{"step", rounding{step: 0.05}, 0.31, roundCPU, 0.35},
+		{"multiple of the step", rounding{step: 0.1}, 0.3, roundCPU, 0.3},
+		{"min", rounding{min: 0.1}, 0.01, roundCPU, 0.1},
+		{"max", rounding{max: 1024}, 2000, roundMemory, 1024},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.rounding.round(tc.value, tc.round); actual != tc.expected {
+				t.Errorf("expected %g, got %g", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRoundingPolicyCompile(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy RoundingPolicy
+		err    string
+	}{
+		{"defaults", RoundingPolicy{}, ""},
+		{"overrides", RoundingPolicy{CPU: ResourceRounding{Step: "50m"}, Overrides: []RoundingOverride{
+			{Namespace: "kube-.*", Memory: ResourceRounding{Min: "64Mi"}},
+		}}, ""},
+		{"invalid quantity", RoundingPolicy{CPU: ResourceRounding{Step: "fast"}}, "invalid cpu step 'fast'"},
+		{"zero", RoundingPolicy{Memory: ResourceRounding{Min: "0"}}, "memory min must be positive, got 0"},
+		{"min above max", RoundingPolicy{CPU: ResourceRounding{Min: "2", Max: "1"}}, "cpu min 2 is greater than max 1"},
+		{"min above inherited max", RoundingPolicy{Memory: ResourceRounding{Max: "1Gi"}, Overrides: []RoundingOverride{
+			{Container: "app", Memory: ResourceRounding{Min: "2Gi"}},
+		}}, "override 1: memory min 2048 is greater than max 1024"},
+		{"invalid pattern", RoundingPolicy{Overrides: []RoundingOverride{{Namespace: "("}}}, "override 1: invalid pattern '('"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.policy.compile()
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadRoundingPolicy(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	if err := os.WriteFile(valid, []byte("cpu:\n  step: 50m\noverrides:\n- container: proxy\n  memory:\n    max: 1Gi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := loadRoundingPolicy(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.CPU.Step != "50m" || len(policy.Overrides) != 1 || policy.Overrides[0].Memory.Max != "1Gi" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	unknown := filepath.Join(dir, "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("cpu:\n  stepp: 50m\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRoundingPolicy(unknown); err == nil || !strings.Contains(err.Error(), "failed to parse rounding config") {
+		t.Errorf("expected parse error of unknown field, got %v", err)
+	}
+}
+
+func TestAnalyzeRoundingOverrides(t *testing.T) {
+	o := &Options{Rounding: RoundingPolicy{
+		CPU:    ResourceRounding{Step: "50m"},
+		Memory: ResourceRounding{Max: "1Gi"},
+		Overrides: []RoundingOverride{
+			// patterns match the whole name, so this does not match proxy
+			{Container: "prox", CPU: ResourceRounding{Step: "1"}},
+			{Namespace: "other", Container: "proxy", CPU: ResourceRounding{Step: "1"}},
+			{Namespace: "n.*", Container: "proxy", CPU: ResourceRounding{Step: "10m", Min: "20m"}},
+			// the first matching override is used
+			{Container: "pro.*", CPU: ResourceRounding{Step: "1"}},
+		},
+	}}
+	usage := webUsage()
+	usage.RequestCPU = map[string]float64{"migrate": 0.31, "proxy": 0.013, "app": 0.21}
+	usage.RequestMem = map[string]float64{"migrate": 200, "proxy": 50, "app": 2000}
+	resp := analyzeFake(t, o, fakeSource{web: usage}, webDeployment())
+
+	for _, tc := range []struct {
+		container string
+		cpu       string
+		memory    string
+	}{
+		{"migrate", "350m", "200Mi"},
+		{"proxy", "20m", "100Mi"},
+		{"app", "250m", "1Gi"},
+	} {
+		t.Run(tc.container, func(t *testing.T) {
+			requests := recommendationOf(t, resp, tc.container).Recommended.Requests
+			assertQuantity(t, tc.container, requests, v1.ResourceCPU, tc.cpu)
+			assertQuantity(t, tc.container, requests, v1.ResourceMemory, tc.memory)
+		})
+	}
+}
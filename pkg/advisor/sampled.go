@@ -0,0 +1,188 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// containerSamples contains the usage samples of a single container, cpu in cores and memory in
+// mebibytes, and the risk statistics over the window when the source provides them.
+type containerSamples struct {
+	CPU       []Sample `json:"cpu"`
+	Memory    []Sample `json:"memory"`
+	Throttled float64  `json:"throttled,omitempty"`
+	OOMKilled float64  `json:"oomKilled,omitempty"`
+	Restarts  float64  `json:"restarts,omitempty"`
+}
+
+// sampledSource is the MetricsSource which computes the usage from the samples of the pods. It is
+// used for metrics-server, which has only the current usage, and for recordings such that they
+// can be replayed with other quantiles and strategies.
+type sampledSource struct {
+	o         *Options
+	mu        sync.Mutex
+	samples   map[containerKey]*containerSamples
+	workloads map[string]map[string]Workload // namespace to pod name to workload
+}
+
+func newSampledSource(o *Options) *sampledSource {
+	return &sampledSource{
+		o:         o,
+		samples:   map[containerKey]*containerSamples{},
+		workloads: map[string]map[string]Workload{},
+	}
+}
+
+func (s *sampledSource) WorkloadUsage(_ context.Context, workload Workload) (Usage, error) {
+	quantile, err := strconv.ParseFloat(s.o.Quantile, 64)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid quantile '%s': %w", s.o.Quantile, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := containerValues{
+		LimitCPU:   map[string][]float64{},
+		LimitMem:   map[string][]float64{},
+		RequestCPU: map[string][]float64{},
+		RequestMem: map[string][]float64{},
+		PeakCPU:    map[string][]float64{},
+		PeakMem:    map[string][]float64{},
+		Throttled:  map[string][]float64{},
+		OOMKilled:  map[string][]float64{},
+		Restarts:   map[string][]float64{},
+	}
+	for k, samples := range s.samples {
+		if s.workloads[k.Namespace][k.Pod] != workload {
+			continue
+		}
+		cpu, memory := sampleValues(samples.CPU), sampleValues(samples.Memory)
+		if len(cpu) > 0 {
+			peak := sampleQuantile(1, cpu)
+			values.RequestCPU[k.Container] = append(values.RequestCPU[k.Container], sampleQuantile(quantile, cpu))
+			values.LimitCPU[k.Container] = append(values.LimitCPU[k.Container], peak)
+			values.PeakCPU[k.Container] = append(values.PeakCPU[k.Container], peak)
+		}
+		if len(memory) > 0 {
+			peak := sampleQuantile(1, memory)
+			values.RequestMem[k.Container] = append(values.RequestMem[k.Container], sampleQuantile(quantile, memory))
+			values.LimitMem[k.Container] = append(values.LimitMem[k.Container], peak)
+			values.PeakMem[k.Container] = append(values.PeakMem[k.Container], peak)
+		}
+		for _, statistic := range []struct {
+			values map[string][]float64
+			value  float64
+		}{
+			{values.Throttled, samples.Throttled},
+			{values.OOMKilled, samples.OOMKilled},
+			{values.Restarts, samples.Restarts},
+		} {
+			if statistic.value > 0 {
+				statistic.values[k.Container] = append(statistic.values[k.Container], statistic.value)
+			}
+		}
+	}
+	return values.peak(), nil
+}
+
+func (s *sampledSource) WorkloadSamples(_ context.Context, workload Workload) (Samples, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := Samples{CPU: map[string][]Sample{}, Memory: map[string][]Sample{}}
+	for k, values := range s.samples {
+		if s.workloads[k.Namespace][k.Pod] != workload {
+			continue
+		}
+		samples.CPU[k.Container] = append(samples.CPU[k.Container], values.CPU...)
+		samples.Memory[k.Container] = append(samples.Memory[k.Container], values.Memory...)
+	}
+	sortSamples(samples.CPU)
+	sortSamples(samples.Memory)
+	return samples, nil
+}
+
+// sampled returns the samples and the risk statistics of the containers of every workload in the
+// namespaces.
+func (p *prometheusSource) sampled(ctx context.Context, namespaces []string) (*sampledSource, error) {
+	if p.o.mode == ModeCustom {
+		return nil, fmt.Errorf("usage samples are not available with custom cpu queries")
+	}
+	source := newSampledSource(p.o)
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(p.o.Concurrency)
+	for _, namespace := range namespaces {
+		group.Go(func() error {
+			fetch, err := p.fetch(groupCtx, namespace)
+			if err != nil {
+				return err
+			}
+			samples, err := p.o.querySamples(groupCtx, namespace)
+			if err != nil {
+				return err
+			}
+
+			source.mu.Lock()
+			defer source.mu.Unlock()
+			source.workloads[namespace] = fetch.metrics.workloads
+			container := func(k containerKey) *containerSamples {
+				if source.samples[k] == nil {
+					source.samples[k] = &containerSamples{}
+				}
+				return source.samples[k]
+			}
+			// pods of workloads which are not analyzed are left out
+			for k, values := range samples.cpu {
+				if _, ok := fetch.metrics.workloads[k.Pod]; ok {
+					container(k).CPU = values
+				}
+			}
+			for k, values := range samples.memory {
+				if _, ok := fetch.metrics.workloads[k.Pod]; ok {
+					container(k).Memory = values
+				}
+			}
+			for k, samples := range source.samples {
+				if k.Namespace != namespace {
+					continue
+				}
+				samples.Throttled = fetch.metrics.series.Throttled[k]
+				samples.OOMKilled = fetch.metrics.series.OOMKilled[k]
+				samples.Restarts = fetch.metrics.series.Restarts[k]
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func sampleValues(samples []Sample) []float64 {
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+	return values
+}
+
+// sampleQuantile returns the quantile of the samples interpolated the same way as
+// quantile_over_time of Prometheus.
+func sampleQuantile(quantile float64, samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	rank := quantile * float64(len(sorted)-1)
+	lower := math.Max(0, math.Floor(rank))
+	upper := math.Min(float64(len(sorted)-1), lower+1)
+	weight := rank - math.Floor(rank)
+	return sorted[int(lower)]*(1-weight) + sorted[int(upper)]*weight
+}
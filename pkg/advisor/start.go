@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -20,7 +21,8 @@ func init() {
 
 // Execute will execute basically the whole application.
 func Execute() {
-	options := &Options{}
+	throttling := defaultThrottlingThreshold
+	options := &Options{Risk: RiskOptions{Throttling: &throttling}}
 	_ = flag.Lookup("logtostderr").Value.Set("true")
 	glog.Flush()
 	rootCmd := &cobra.Command{
@@ -37,10 +39,48 @@ func Execute() {
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&options.Namespaces, "namespaces", "n", "", "Comma separated namespaces to be scanned")
-	rootCmd.Flags().StringVarP(&options.NamespaceSelector, "namespace-selector", "l", "", "Namespace selector")
-	rootCmd.Flags().StringVarP(&options.Quantile, "quantile", "q", "0.95", "Quantile to be used")
-	rootCmd.Flags().StringVarP(&options.LimitMargin, "limit-margin", "m", "1.2", "Limit margin")
+	rootCmd.PersistentFlags().StringVarP(&options.Namespaces, "namespaces", "n", "", "Comma separated namespaces to be scanned")
+	rootCmd.PersistentFlags().StringVarP(&options.NamespaceSelector, "namespace-selector", "l", "", "Namespace selector")
+	rootCmd.PersistentFlags().StringVarP(&options.Quantile, "quantile", "q", "0.95", "Quantile to be used")
+	rootCmd.PersistentFlags().StringVarP(&options.LimitMargin, "limit-margin", "m", "1.2", "Limit margin")
+	rootCmd.PersistentFlags().StringVar(&options.Window, "window", "", "Lookback window of the usage history, for example 3d, 2w or 30d, defaults to 1w")
+	rootCmd.PersistentFlags().StringVar(&options.At, "at", "", "Evaluation time as RFC 3339 or unix timestamp, defaults to now")
+	rootCmd.PersistentFlags().StringVar(&options.QueryConfig, "query-config", "", "Yaml file with user-defined PromQL query templates")
+	rootCmd.PersistentFlags().StringVar(&options.Strategy, "strategy", StrategyQuantile, "Recommendation strategy, one of quantile or histogram")
+	rootCmd.PersistentFlags().DurationVar(&options.Histogram.HalfLife, "histogram-half-life", defaultHalfLife, "Age at which a usage sample has half the weight of a current one with the histogram strategy")
+	rootCmd.PersistentFlags().Float64Var(&options.Histogram.Percentile, "histogram-percentile", defaultPercentile, "Percentile of the weighted usage requested with the histogram strategy")
+	rootCmd.PersistentFlags().Float64Var(&options.Histogram.Margin, "histogram-margin", defaultMargin, "Multiplier of the percentile with the histogram strategy")
+	rootCmd.PersistentFlags().StringVar(&options.LimitPolicy.CPU, "cpu-limit-policy", LimitPolicyMargin, "How cpu limits are recommended, one of margin, none, request, ratio or current")
+	rootCmd.PersistentFlags().StringVar(&options.LimitPolicy.Memory, "memory-limit-policy", LimitPolicyMargin, "How memory limits are recommended, one of margin, none, request, ratio or current")
+	rootCmd.PersistentFlags().Float64Var(&options.LimitPolicy.CPURatio, "cpu-limit-ratio", 0, "Cpu limit as a multiple of the request with the ratio policy")
+	rootCmd.PersistentFlags().Float64Var(&options.LimitPolicy.MemoryRatio, "memory-limit-ratio", 0, "Memory limit as a multiple of the request with the ratio policy")
+	rootCmd.PersistentFlags().Float64Var(options.Risk.Throttling, "throttling-threshold", defaultThrottlingThreshold, "Fraction of throttled cpu periods above which the cpu recommendation is raised, 0 raises any throttled container")
+	rootCmd.PersistentFlags().Float64Var(&options.Risk.Increase, "risk-increase", defaultRiskIncrease, "Multiplier of the recommendations of throttled and OOM killed containers, 1 only flags them")
+	rootCmd.PersistentFlags().StringVar(&options.RoundingConfig, "rounding-config", "", "YAML file with steps, minimums and maximums of the recommendations")
+	rootCmd.PersistentFlags().StringVar(&options.Source, "metrics-source", SourceAuto, "Source of usage metrics, one of auto, prometheus or metrics-server")
+	rootCmd.PersistentFlags().DurationVar(&options.SampleDuration, "sample-duration", 5*time.Minute, "How long usage is sampled from metrics-server")
+	rootCmd.PersistentFlags().IntVar(&options.Concurrency, "concurrency", 4, "Number of namespaces analyzed at the same time, and of queries run at the same time for each of them")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.URL, "prometheus-url", "", "Prometheus compatible HTTP API to query instead of discovering prometheus-operator from the cluster")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.BearerToken, "prometheus-token", "", "Bearer token for Prometheus")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.BearerTokenFile, "prometheus-token-file", "", "File containing bearer token for Prometheus")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.Username, "prometheus-username", "", "Basic auth username for Prometheus")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.Password, "prometheus-password", "", "Basic auth password for Prometheus")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.CAFile, "prometheus-ca-file", "", "CA certificate file for verifying Prometheus")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.CertFile, "prometheus-cert-file", "", "Client certificate file for Prometheus")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.KeyFile, "prometheus-key-file", "", "Client key file for Prometheus")
+	rootCmd.PersistentFlags().BoolVar(&options.Prometheus.InsecureSkipVerify, "prometheus-insecure-skip-verify", false, "Skip verifying Prometheus certificate")
+	rootCmd.PersistentFlags().StringVar(&options.Prometheus.Tenant, "prometheus-tenant", "", "Tenant sent in the X-Scope-OrgID header to Mimir, Cortex or Thanos")
+	rootCmd.PersistentFlags().StringArrayVar(&options.Prometheus.Matchers, "prometheus-matcher", nil, "Label matcher added to every query, for example cluster=\"prod\", can be repeated")
+	rootCmd.PersistentFlags().Float64Var(&options.Prometheus.QueryRate, "prometheus-query-rate", 0, "Maximum Prometheus queries per second, 0 means unlimited")
+	rootCmd.PersistentFlags().IntVar(&options.Prometheus.MaxInFlight, "prometheus-max-in-flight", 0, "Maximum Prometheus queries running at the same time, defaults to --concurrency")
+	rootCmd.PersistentFlags().DurationVar(&options.Prometheus.Timeout, "prometheus-timeout", 5*time.Minute, "Timeout of a single Prometheus query")
+	rootCmd.PersistentFlags().StringToStringVar(&options.Prometheus.Headers, "prometheus-header", nil, "Extra header for Prometheus requests in name=value format, can be repeated")
+	rootCmd.Flags().StringVarP(&options.Output, "output", "o", OutputTable, "Output format, one of table, json, yaml or csv")
+	rootCmd.Flags().StringVar(&options.PatchFormat, "patch-format", PatchStrategic, "Patch format, one of strategic or json")
+	rootCmd.Flags().StringVar(&options.PatchFile, "patch-file", "", "Write patches of all workloads as multi-document yaml to this file")
+	rootCmd.Flags().StringVar(&options.PatchDir, "patch-dir", "", "Write patch of each workload to a separate file in this directory")
+	rootCmd.Flags().StringVar(&options.Record, "record", "", "Record the workloads and usage samples of the run to this directory")
+	rootCmd.Flags().StringVar(&options.Replay, "replay", "", "Analyze a recording made with --record instead of the cluster")
 
 	rootCmd.Flags().BoolP("version", "v", false, "Print version and exit")
 	rootCmd.PreRun = func(cmd *cobra.Command, args []string) {
@@ -50,8 +90,58 @@ func Execute() {
 		}
 	}
 
+	rootCmd.AddCommand(newApplyCommand(options))
+	rootCmd.AddCommand(newUndoCommand(options))
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
+
+func newApplyCommand(options *Options) *cobra.Command {
+	applyOptions := &ApplyOptions{Options: options}
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply recommendations to workloads",
+		Long:  "Apply the recommended requests and limits to deployments, statefulsets and daemonsets using server-side apply",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, err := Apply(applyOptions)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+		},
+	}
+
+	applyCmd.Flags().StringVar(&applyOptions.DryRun, "dry-run", DryRunNone, "Dry-run mode, one of none or server")
+	applyCmd.Flags().BoolVarP(&applyOptions.AssumeYes, "yes", "y", false, "Apply without asking confirmation for each workload")
+	applyCmd.Flags().BoolVar(&applyOptions.ForceConflicts, "force-conflicts", false, "Take ownership of resources managed by other field managers")
+	return applyCmd
+}
+
+func newUndoCommand(options *Options) *cobra.Command {
+	undoOptions := &UndoOptions{ApplyOptions: &ApplyOptions{Options: options}}
+	undoCmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Restore resources changed by apply",
+		Long:  "Restore the requests and limits which workloads had before they were changed by apply",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, err := Undo(undoOptions)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+		},
+	}
+
+	undoCmd.Flags().StringVarP(&undoOptions.Workload, "workload", "w", "", "Restore only this workload, for example deployment/foo")
+	undoCmd.Flags().StringVar(&undoOptions.RunID, "run-id", "", "Restore only workloads changed by this apply run")
+	undoCmd.Flags().BoolVarP(&undoOptions.AllNamespaces, "all-namespaces", "A", false, "Restore workloads in all namespaces")
+	undoCmd.Flags().StringVar(&undoOptions.DryRun, "dry-run", DryRunNone, "Dry-run mode, one of none or server")
+	undoCmd.Flags().BoolVarP(&undoOptions.AssumeYes, "yes", "y", false, "Restore without asking confirmation for each workload")
+	undoCmd.Flags().BoolVar(&undoOptions.ForceConflicts, "force-conflicts", false, "Take ownership of resources managed by other field managers")
+	return undoCmd
+}
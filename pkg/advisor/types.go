@@ -1,9 +1,13 @@
 package advisor
 
 import (
+	"io"
 	"net/http"
 	"net/url"
+	"time"
 
+	"golang.org/x/time/rate"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -14,26 +18,125 @@ type Options struct {
 	Namespaces        string
 	Quantile          string
 	LimitMargin       string
+	Window            string // lookback window such as 3d, 2w or 30d, defaults to 1w
+	At                string // evaluation time as RFC 3339 or unix timestamp, defaults to now
+	Concurrency       int    // namespaces analyzed and queries of a namespace run at the same time, defaults to 4
+	QueryConfig       string // yaml file with user-defined query templates, overrides Queries
+	Queries           QueryTemplates
+	Output            string    // table, json, yaml or csv, defaults to table
+	Out               io.Writer // defaults to os.Stdout
+	PatchFormat       string    // strategic or json, defaults to strategic
+	PatchFile         string    // write patches of all workloads to this file
+	PatchDir          string    // write patch of each workload to a separate file in this directory
+	Prometheus        PrometheusOptions
+	Metrics           MetricsSource // overrides Source
+	Source            string        // auto, prometheus or metrics-server, defaults to auto
+	SampleDuration    time.Duration // how long metrics-server is sampled, defaults to 5 minutes
+	Recommender       Recommender   // overrides Strategy
+	Strategy          string        // name of the built-in Recommender, defaults to quantile
+	Histogram         HistogramOptions
+	LimitPolicy       LimitPolicy
+	Risk              RiskOptions
+	RoundingConfig    string // yaml file with the rounding policy, overrides Rounding
+	Rounding          RoundingPolicy
+	Record            string // write the workloads and usage samples of the run to this directory
+	Replay            string // analyze a recording of an earlier run instead of the cluster
 	promClient        *promClient
-	Client            *kubernetes.Clientset
-	mode              string // sum_irate or sum_rate, older prometheusrules uses sum_rate but newest uses sum_irate
+	recommender       Recommender
+	rounding          *roundingPolicy
+	Client            kubernetes.Interface
+	mode              string // source of cpu usage, one of the Mode constants
+	history           string // owners when kube-state-metrics is available, pods otherwise
+	at                time.Time
+	defaultWindow     bool // Window was not set
 }
 
+// Sources of cpu usage.
+const (
+	ModeSumIrate = "sum_irate" // recording rule of newer kube-prometheus versions
+	ModeSumRate  = "sum_rate"  // recording rule of older kube-prometheus versions
+	ModeRaw      = "raw"       // rate computed from cAdvisor metrics when the recording rules are missing
+	ModeCustom   = "custom"    // user-defined query templates
+	// usage sampled from metrics-server for the sample duration, short window and low confidence
+	ModeMetricsServer = "metrics-server"
+)
+
+// Sources of usage metrics.
+const (
+	SourceAuto          = "auto" // prometheus, or metrics-server when prometheus-operator is not detected
+	SourcePrometheus    = "prometheus"
+	SourceMetricsServer = "metrics-server"
+)
+
+// Sources of the pods whose usage is analyzed.
+const (
+	HistoryOwners = "owners" // every pod the workload had during the lookback window, from kube-state-metrics
+	HistoryPods   = "pods"   // pods of the workload which currently exist
+)
+
 // Response contains struct to get response from resource-advisor.
 type Response struct {
-	Data    [][]string
-	CPUSave float64
-	MemSave int64
+	Recommendations []Recommendation
+	Totals          ReportSavings // savings of the long running workloads, cronjobs and jobs are not included
+	Warnings        []string      // workloads whose QoS class would change
+	CPUSave         float64
+	MemSave         int64
+}
+
+// Workload kinds used in recommendations.
+const (
+	KindDeployment  = "deployment"
+	KindStatefulSet = "statefulset"
+	KindDaemonSet   = "daemonset"
+	KindCronJob     = "cronjob"
+	KindJob         = "job"
+)
+
+// Container types used in recommendations.
+const (
+	ContainerTypeApp     = "app"
+	ContainerTypeInit    = "init"
+	ContainerTypeSidecar = "sidecar" // init container with restartPolicy Always
+)
+
+// Recommendation contains the current and the recommended resources for a single container.
+type Recommendation struct {
+	Namespace     string
+	Kind          string
+	Name          string
+	Container     string
+	ContainerType string
+	Replicas      int32
+	Current       v1.ResourceRequirements
+	Recommended   v1.ResourceRequirements
+	CPUSave       float64  // cores saved by changing the pod request, multiplied by replicas
+	MemSave       float64  // bytes saved by changing the pod request, multiplied by replicas
+	Risk          []string // reasons the container may be under-provisioned, see the Risk constants
+	index         int      // index of the container in containers or initContainers of the pod template
 }
 
 type promClient struct {
 	endpoint *url.URL
 	client   *http.Client
+	limiter  *rate.Limiter // nil when the query rate is not limited
+	inFlight chan struct{} // nil when concurrent queries are not limited
+}
+
+// containerKey identifies a single container series in Prometheus.
+type containerKey struct {
+	Namespace string
+	Pod       string
+	Container string
 }
 
-type prometheusMetrics struct {
-	LimitCPU   map[string]float64
-	LimitMem   map[string]float64
-	RequestCPU map[string]float64
-	RequestMem map[string]float64
+type seriesMetrics struct {
+	LimitCPU   map[containerKey]float64
+	LimitMem   map[containerKey]float64
+	RequestCPU map[containerKey]float64
+	RequestMem map[containerKey]float64
+	PeakCPU    map[containerKey]float64
+	PeakMem    map[containerKey]float64
+	Throttled  map[containerKey]float64
+	OOMKilled  map[containerKey]float64
+	Restarts   map[containerKey]float64
 }
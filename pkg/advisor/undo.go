@@ -0,0 +1,316 @@
+package advisor
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PreviousResourcesAnnotation is set by apply on every modified workload. It contains the container
+// resources before the change and is used by undo to restore them.
+const PreviousResourcesAnnotation = "resource-advisor.elisa.fi/previous-resources"
+
+// UndoOptions contains struct to call resource-advisor undo.
+type UndoOptions struct {
+	*ApplyOptions
+	Workload      string // restore only this workload, in kind/name format
+	RunID         string // restore only workloads modified by this apply run
+	AllNamespaces bool   // look for modified workloads in all namespaces
+}
+
+// previousResources is stored in the PreviousResourcesAnnotation.
+type previousResources struct {
+	RunID      string                             `json:"runID"`
+	AppliedAt  time.Time                          `json:"appliedAt"`
+	Containers map[string]v1.ResourceRequirements `json:"containers"`
+}
+
+// appliedWorkload is a workload which has been modified by apply.
+type appliedWorkload struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Spec      v1.PodSpec
+	Previous  previousResources
+}
+
+// newRunID returns the time of the run with a random suffix such that runs started within the same
+// second get different IDs.
+func newRunID() string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
+
+// managedResources returns only the resources which are managed by the advisor.
+func managedResources(list v1.ResourceList) v1.ResourceList {
+	managed := v1.ResourceList{}
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		if q, ok := list[name]; ok {
+			managed[name] = q
+		}
+	}
+	return managed
+}
+
+func previousResourcesAnnotation(runID string, appliedAt time.Time, recommendations []Recommendation) (string, error) {
+	previous := previousResources{
+		RunID:      runID,
+		AppliedAt:  appliedAt,
+		Containers: map[string]v1.ResourceRequirements{},
+	}
+	for _, rec := range recommendations {
+		previous.Containers[rec.Container] = v1.ResourceRequirements{
+			Requests: managedResources(rec.Current.Requests),
+			Limits:   managedResources(rec.Current.Limits),
+		}
+	}
+	out, err := json.Marshal(previous)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal previous resources: %w", err)
+	}
+	return string(out), nil
+}
+
+// Undo restores the resources recorded by apply to the workloads.
+func Undo(o *UndoOptions) ([]ApplyResult, error) {
+	o.loadDefaults()
+	if o.DryRun != DryRunNone && o.DryRun != DryRunServer {
+		return nil, fmt.Errorf("unsupported dry-run mode '%s', supported modes are %s and %s", o.DryRun, DryRunNone, DryRunServer)
+	}
+	if o.Workload != "" && len(strings.Split(o.Workload, "/")) != 2 {
+		return nil, fmt.Errorf("workload must be in kind/name format, got '%s'", o.Workload)
+	}
+
+	var err error
+	if o.Client == nil {
+		o.Client, err = newClientSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	namespaces := []string{metav1.NamespaceAll}
+	if !o.AllNamespaces {
+		o.usedNamespaces, err = buildUsedNamespaces(ctx, o.Options)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = strings.Split(o.usedNamespaces, ",")
+	}
+
+	workloads := []appliedWorkload{}
+	for _, namespace := range namespaces {
+		found, err := o.listAppliedWorkloads(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, applied := range found {
+			if o.Workload == "" || o.Workload == fmt.Sprintf("%s/%s", applied.Kind, applied.Name) {
+				workloads = append(workloads, applied)
+			}
+		}
+	}
+	if o.RunID != "" {
+		workloads, err = selectRun(workloads, o.RunID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        o.ForceConflicts,
+	}
+	if o.DryRun == DryRunServer {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	in := bufio.NewReader(o.In)
+	results := []ApplyResult{}
+	failed := 0
+	for _, applied := range workloads {
+		workload := applied.restore()
+		result := ApplyResult{
+			RunID:           applied.Previous.RunID,
+			Namespace:       workload.Namespace,
+			Kind:            workload.Kind,
+			Name:            workload.Name,
+			Recommendations: workload.Recommendations,
+		}
+		if !o.AssumeYes && !o.confirm(in, workload) {
+			result.Status = ApplyStatusSkipped
+		} else {
+			result.Status = ApplyStatusApplied
+			if o.DryRun == DryRunServer {
+				result.Status = ApplyStatusDryRun
+			}
+			if err := o.applyWorkload(ctx, workload, opts); err != nil {
+				result.Status = ApplyStatusFailed
+				result.Error = err
+				failed++
+			}
+		}
+		results = append(results, result)
+	}
+
+	if err := renderApplySummary(o.Out, results); err != nil {
+		return results, err
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("failed to undo %d workloads", failed)
+	}
+	return results, nil
+}
+
+// selectRun returns the workloads last modified by apply run runID. The annotation keeps only the
+// latest run, so the run cannot be undone when none of the workloads has it or when workloads have
+// been modified by a later run which may have replaced the resources recorded by it.
+func selectRun(workloads []appliedWorkload, runID string) ([]appliedWorkload, error) {
+	selected := []appliedWorkload{}
+	for _, applied := range workloads {
+		if applied.Previous.RunID == runID {
+			selected = append(selected, applied)
+		}
+	}
+	if len(selected) == 0 {
+		runs := map[string]bool{}
+		for _, applied := range workloads {
+			runs[applied.Previous.RunID] = true
+		}
+		found := make([]string, 0, len(runs))
+		for run := range runs {
+			found = append(found, run)
+		}
+		sort.Strings(found)
+		return nil, fmt.Errorf("no workload was last modified by apply run %s, found runs: [%s]", runID, strings.Join(found, ", "))
+	}
+
+	appliedAt := selected[0].Previous.AppliedAt
+	later := []string{}
+	for _, applied := range workloads {
+		if applied.Previous.RunID != runID && applied.Previous.AppliedAt.After(appliedAt) {
+			later = append(later, fmt.Sprintf("%s/%s in namespace %s (run %s)", applied.Kind, applied.Name, applied.Namespace, applied.Previous.RunID))
+		}
+	}
+	if len(later) > 0 {
+		return nil, fmt.Errorf("apply run %s cannot be undone completely, workloads have been modified by later runs: %s", runID, strings.Join(later, ", "))
+	}
+	return selected, nil
+}
+
+// restore returns the previous resources of the workload in the same form as recommendations such
+// that they can be applied the same way. The annotation is left out which removes it from the
+// workload as it is owned by the advisor field manager.
+func (a appliedWorkload) restore() workloadRecommendations {
+	workload := workloadRecommendations{
+		Namespace: a.Namespace,
+		Kind:      a.Kind,
+		Name:      a.Name,
+	}
+	add := func(container v1.Container, containerType string, index int) {
+		previous, ok := a.Previous.Containers[container.Name]
+		if !ok {
+			return
+		}
+		workload.Recommendations = append(workload.Recommendations, Recommendation{
+			Namespace:     a.Namespace,
+			Kind:          a.Kind,
+			Name:          a.Name,
+			Container:     container.Name,
+			ContainerType: containerType,
+			Current:       container.Resources,
+			Recommended:   previous,
+			index:         index,
+		})
+	}
+	for i, container := range a.Spec.InitContainers {
+		add(container, containerType(container), i)
+	}
+	for i, container := range a.Spec.Containers {
+		add(container, ContainerTypeApp, i)
+	}
+	return workload
+}
+
+func newAppliedWorkload(meta metav1.ObjectMeta, kind string, spec v1.PodSpec) (*appliedWorkload, error) {
+	annotation, ok := meta.Annotations[PreviousResourcesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	applied := &appliedWorkload{
+		Namespace: meta.Namespace,
+		Kind:      kind,
+		Name:      meta.Name,
+		Spec:      spec,
+	}
+	if err := json.Unmarshal([]byte(annotation), &applied.Previous); err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s of %s/%s: %w", PreviousResourcesAnnotation, kind, meta.Name, err)
+	}
+	return applied, nil
+}
+
+func (o *UndoOptions) listAppliedWorkloads(ctx context.Context, namespace string) ([]appliedWorkload, error) {
+	workloads := []appliedWorkload{}
+	add := func(meta metav1.ObjectMeta, kind string, spec v1.PodSpec) error {
+		applied, err := newAppliedWorkload(meta, kind, spec)
+		if err != nil {
+			return err
+		}
+		if applied != nil {
+			workloads = append(workloads, *applied)
+		}
+		return nil
+	}
+
+	deployments, err := o.Client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments.Items {
+		if err := add(deployment.ObjectMeta, KindDeployment, deployment.Spec.Template.Spec); err != nil {
+			return nil, err
+		}
+	}
+
+	statefulSets, err := o.Client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets.Items {
+		if err := add(statefulSet.ObjectMeta, KindStatefulSet, statefulSet.Spec.Template.Spec); err != nil {
+			return nil, err
+		}
+	}
+
+	daemonSets, err := o.Client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, daemonSet := range daemonSets.Items {
+		if err := add(daemonSet.ObjectMeta, KindDaemonSet, daemonSet.Spec.Template.Spec); err != nil {
+			return nil, err
+		}
+	}
+
+	cronJobs, err := o.Client.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, cronJob := range cronJobs.Items {
+		if err := add(cronJob.ObjectMeta, KindCronJob, cronJob.Spec.JobTemplate.Spec.Template.Spec); err != nil {
+			return nil, err
+		}
+	}
+	return workloads, nil
+}
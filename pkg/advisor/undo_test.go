@@ -0,0 +1,120 @@
+package advisor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAnalyzeRestoreRoundTrip(t *testing.T) {
+	deployment := webDeployment()
+	resp := analyzeFake(t, &Options{}, fakeSource{web: webUsage()}, deployment)
+	workload := groupByWorkload(resp.Recommendations)[0]
+
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	annotation, err := previousResourcesAnnotation("run-1", appliedAt, workload.Recommendations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the workload after apply has the recommended resources and the annotation
+	applied := deployment.DeepCopy()
+	applied.Annotations = map[string]string{PreviousResourcesAnnotation: annotation}
+	for _, rec := range workload.Recommendations {
+		containers := applied.Spec.Template.Spec.Containers
+		if rec.ContainerType != ContainerTypeApp {
+			containers = applied.Spec.Template.Spec.InitContainers
+		}
+		containers[rec.index].Resources = rec.Recommended
+	}
+
+	previous, err := newAppliedWorkload(applied.ObjectMeta, KindDeployment, applied.Spec.Template.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.Previous.RunID != "run-1" || !previous.Previous.AppliedAt.Equal(appliedAt) {
+		t.Errorf("expected run-1 applied at %s, got %v", appliedAt, previous.Previous)
+	}
+	restored := previous.restore()
+	if len(restored.Recommendations) != len(workload.Recommendations) {
+		t.Fatalf("expected %d containers, got %v", len(workload.Recommendations), restored.Recommendations)
+	}
+	for i, rec := range restored.Recommendations {
+		original := workload.Recommendations[i]
+		if rec.Container != original.Container || rec.ContainerType != original.ContainerType || rec.index != original.index {
+			t.Errorf("expected %s container %s at %d, got %s container %s at %d",
+				original.ContainerType, original.Container, original.index, rec.ContainerType, rec.Container, rec.index)
+		}
+		if !reflect.DeepEqual(rec.Current, original.Recommended) {
+			t.Errorf("%s: expected current resources %v, got %v", rec.Container, original.Recommended, rec.Current)
+		}
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			for _, list := range []struct {
+				name     string
+				restored v1.ResourceList
+				original v1.ResourceList
+			}{
+				{rec.Container + " requests", rec.Recommended.Requests, original.Current.Requests},
+				{rec.Container + " limits", rec.Recommended.Limits, original.Current.Limits},
+			} {
+				expected := ""
+				if q, ok := list.original[name]; ok {
+					expected = q.String()
+				}
+				assertQuantity(t, list.name, list.restored, name, expected)
+			}
+		}
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	first, second := newRunID(), newRunID()
+	if first == second {
+		t.Errorf("expected different run IDs, got %s twice", first)
+	}
+	if len(first) != len("20060102-150405-01234567") {
+		t.Errorf("expected time and random suffix, got %s", first)
+	}
+}
+
+func TestSelectRun(t *testing.T) {
+	applied := func(name string, runID string, minute int) appliedWorkload {
+		return appliedWorkload{Namespace: "ns", Kind: KindDeployment, Name: name, Previous: previousResources{
+			RunID:     runID,
+			AppliedAt: time.Date(2026, 1, 2, 3, minute, 0, 0, time.UTC),
+		}}
+	}
+	for _, tc := range []struct {
+		name      string
+		workloads []appliedWorkload
+		runID     string
+		selected  []string
+		err       string
+	}{
+		{"run", []appliedWorkload{applied("a", "run-1", 1), applied("b", "run-1", 1), applied("c", "run-0", 0)}, "run-1", []string{"a", "b"}, ""},
+		{"unknown run", []appliedWorkload{applied("a", "run-2", 2), applied("b", "run-1", 1)}, "run-0", nil, "no workload was last modified by apply run run-0, found runs: [run-1, run-2]"},
+		{"later run", []appliedWorkload{applied("a", "run-2", 2), applied("b", "run-1", 1)}, "run-1", nil, "workloads have been modified by later runs: deployment/a in namespace ns (run run-2)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, err := selectRun(tc.workloads, tc.runID)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, workload := range selected {
+				names = append(names, workload.Name)
+			}
+			if !reflect.DeepEqual(names, tc.selected) {
+				t.Errorf("expected %v, got %v", tc.selected, names)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package advisor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -13,8 +14,7 @@ import (
 
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	prommodel "github.com/prometheus/common/model"
-	appsv1 "k8s.io/api/apps/v1"
-	v1 "k8s.io/api/core/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -23,13 +23,32 @@ import (
 
 const (
 	promOperatorClusterURL = "%s/api/v1/namespaces/%s/services/prometheus-operated:%s/proxy/"
-	podCPURequest          = `quantile_over_time(%s, node_namespace_pod_container:container_cpu_usage_seconds_total:%s{pod="%s", container!=""}[1w])`
-	podCPULimit            = `max_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:%s{pod="%s", container!=""}[1w]) * %s`
-	podMemoryRequest       = `quantile_over_time(%s, container_memory_working_set_bytes{pod="%s", container!=""}[1w]) / 1024 / 1024`
-	podMemoryLimit         = `(max_over_time(container_memory_working_set_bytes{pod="%s", container!=""}[1w]) / 1024 / 1024) * %s`
-	deploymentRevision     = "deployment.kubernetes.io/revision"
+	ruleCPUUsageRange      = `node_namespace_pod_container:container_cpu_usage_seconds_total:%s{%s}[%s]`
+	rawCPUUsageRange       = `(sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{%s, image!=""}[5m])))[%s:1m]`
+	podCPURequest          = `quantile_over_time(%s, %s)`
+	podMemoryRequest       = `quantile_over_time(%s, container_memory_working_set_bytes{%s}[%s]) / 1024 / 1024`
+	podCPUPeak             = `max_over_time(%s)`
+	podMemoryPeak          = `max_over_time(container_memory_working_set_bytes{%s}[%s]) / 1024 / 1024`
+	podCPUThrottled        = `sum by (namespace, pod, container) (increase(container_cpu_cfs_throttled_periods_total{%s}[%s])) / sum by (namespace, pod, container) (increase(container_cpu_cfs_periods_total{%s}[%s]))`
+	podOOMKilled           = `max_over_time(kube_pod_container_status_last_terminated_reason{%s, reason="OOMKilled"}[%s]) and on (namespace, pod, container) increase(kube_pod_container_status_restarts_total{%s}[%s]) > 0`
+	podRestarts            = `increase(kube_pod_container_status_restarts_total{%s}[%s])`
+	cpuUsage               = `count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:%s{%s}[%s]))`
+	rawCPUUsage            = `count(last_over_time(container_cpu_usage_seconds_total{%s}[%s]))`
+	ruleCPUUsage           = `node_namespace_pod_container:container_cpu_usage_seconds_total:%s{%s}`
+	rawCPUUsage5m          = `sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{%s, image!=""}[5m]))`
+	podMemoryUsage         = `container_memory_working_set_bytes{%s} / 1024 / 1024`
+	sampleStep             = 5 * time.Minute
+	maxRangeSamples        = 10000
+	podOwner               = `count(last_over_time(kube_pod_owner{%s}[%s]))`
+	detectLookback         = time.Hour
+	groupByContainer       = `max by (namespace, pod, container) (%s)`
+	podOwners              = `max by (namespace, pod, owner_kind, owner_name) (max_over_time(kube_pod_owner{%s}[%s]))`
+	replicaSetOwners       = `max by (namespace, replicaset, owner_kind, owner_name) (max_over_time(kube_replicaset_owner{%s}[%s]))`
+	jobOwners              = `max by (namespace, job_name, owner_kind, owner_name) (max_over_time(kube_job_owner{%s}[%s]))`
 )
 
+var errPrometheusNotDetected = errors.New("prometheus-operator not detected")
+
 func findConfig() (*rest.Config, string, error) {
 	cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
 	if err != nil {
@@ -54,64 +73,112 @@ func newClientSet() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
-func queryStatistic(ctx context.Context, client *promClient, request string, now time.Time) (map[string]float64, error) {
-	output := make(map[string]float64)
+func queryStatistic(ctx context.Context, client *promClient, request string, now time.Time) (map[containerKey]float64, error) {
 	response, err := queryPrometheus(ctx, client, request, now)
 	if err != nil {
-		return output, fmt.Errorf("error querying statistic %w", err)
+		return map[containerKey]float64{}, fmt.Errorf("error querying statistic %w", err)
 	}
 	asSamples, ok := response.(prommodel.Vector)
 	if !ok {
-		return output, fmt.Errorf("error converting response to vector")
-	}
-	sampleArray := []*prommodel.Sample{}
-	for _, sample := range asSamples {
-		sampleArray = append(sampleArray, sample)
+		return map[containerKey]float64{}, fmt.Errorf("error converting response to vector")
 	}
+	return aggregateSamples(asSamples), nil
+}
 
-	highest := float64(0.00)
-	for _, item := range sampleArray {
-		containerName := ""
-		for k, v := range item.Metric {
-			if k == "container" {
-				containerName = string(v)
-			}
+// aggregateSamples returns the highest value of each container. Every container is kept, a
+// container can have several series for example when it has been restarted.
+func aggregateSamples(samples prommodel.Vector) map[containerKey]float64 {
+	output := make(map[containerKey]float64)
+	for _, item := range samples {
+		key := containerKey{
+			Namespace: string(item.Metric["namespace"]),
+			Pod:       string(item.Metric["pod"]),
+			Container: string(item.Metric["container"]),
+		}
+		value := float64(item.Value)
+		if math.IsNaN(value) {
+			continue
 		}
-		if float64(item.Value) > highest {
-			output[containerName] = float64(item.Value)
-			highest = float64(item.Value)
+		if current, ok := output[key]; !ok || value > current {
+			output[key] = value
 		}
 	}
-
-	return output, nil
+	return output
 }
 
-func (o *Options) queryPrometheusForPod(ctx context.Context, client *promClient, pod v1.Pod) (prometheusMetrics, error) {
-	now := time.Now()
-	var err error
-
-	output := prometheusMetrics{}
-	output.RequestCPU, err = queryStatistic(ctx, client, fmt.Sprintf(podCPURequest, o.Quantile, o.mode, pod.Name), now)
+// queryRange returns the samples of each container between the start and the end of the range.
+func queryRange(ctx context.Context, client *promClient, request string, r promv1.Range) (map[containerKey][]Sample, error) {
+	promcli := promv1.NewAPI(client)
+	response, _, err := promcli.QueryRange(ctx, request, r)
 	if err != nil {
-		return output, err
+		return nil, fmt.Errorf("error querying samples %w", err)
 	}
-
-	output.LimitCPU, err = queryStatistic(ctx, client, fmt.Sprintf(podCPULimit, o.mode, pod.Name, o.LimitMargin), now)
-	if err != nil {
-		return output, err
+	matrix, ok := response.(prommodel.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("error converting response to matrix")
+	}
+	output := make(map[containerKey][]Sample)
+	for _, series := range matrix {
+		key := containerKey{
+			Namespace: string(series.Metric["namespace"]),
+			Pod:       string(series.Metric["pod"]),
+			Container: string(series.Metric["container"]),
+		}
+		for _, pair := range series.Values {
+			if math.IsNaN(float64(pair.Value)) {
+				continue
+			}
+			output[key] = append(output[key], Sample{Time: pair.Timestamp.Time(), Value: float64(pair.Value)})
+		}
 	}
+	return output, nil
+}
 
-	output.RequestMem, err = queryStatistic(ctx, client, fmt.Sprintf(podMemoryRequest, o.Quantile, pod.Name), now)
+// detectHistory checks whether kube-state-metrics ownership information is available.
+func (o *Options) detectHistory(ctx context.Context) (string, error) {
+	found, err := o.detect(ctx, func(selector string, lookback string) string {
+		return fmt.Sprintf(podOwner, selector, lookback)
+	})
 	if err != nil {
-		return output, err
+		return "", fmt.Errorf("error detecting history %w", err)
+	}
+	if found >= 0 {
+		return HistoryOwners, nil
 	}
+	return HistoryPods, nil
+}
 
-	output.LimitMem, err = queryStatistic(ctx, client, fmt.Sprintf(podMemoryLimit, pod.Name, o.LimitMargin), now)
-	if err != nil {
-		return output, err
+// detectLookbacks returns the ranges checked when detecting the available metrics: a short range
+// before the evaluation time first and the whole window only when there was no recent data, for
+// example when the namespaces contain only cronjobs.
+func (o *Options) detectLookbacks() []string {
+	window, err := prommodel.ParseDuration(o.Window)
+	if err != nil || time.Duration(window) <= detectLookback {
+		return []string{o.Window}
 	}
+	return []string{prommodel.Duration(detectLookback).String(), o.Window}
+}
 
-	return output, nil
+// detect returns the index of the first query which has data in the analyzed namespaces, or -1
+// when none of them has. The queries are built from a selector and a range.
+func (o *Options) detect(ctx context.Context, queries ...func(selector string, lookback string) string) (int, error) {
+	selector := o.selector(fmt.Sprintf(`namespace=~"%s"`, strings.ReplaceAll(o.usedNamespaces, ",", "|")))
+	for _, lookback := range o.detectLookbacks() {
+		for i, query := range queries {
+			response, err := queryPrometheus(ctx, o.promClient, query(selector, lookback), o.at)
+			if err != nil {
+				return -1, err
+			}
+			asSamples, ok := response.(prommodel.Vector)
+			if !ok {
+				return -1, fmt.Errorf("error converting response to vector")
+			}
+			if len(asSamples) > 0 {
+				return i, nil
+			}
+		}
+	}
+	return -1, nil
 }
 
 func float64Peak(input []float64) float64 {
@@ -124,21 +191,7 @@ func float64Peak(input []float64) float64 {
 	return highest
 }
 
-func findReplicaset(replicasets *appsv1.ReplicaSetList, dep appsv1.Deployment) (*appsv1.ReplicaSet, error) {
-	generation, ok := dep.Annotations[deploymentRevision]
-	if !ok {
-		return nil, fmt.Errorf("could not find label %s for deployment '%s'", deploymentRevision, dep.Name)
-	}
-	for _, replicaset := range replicasets.Items {
-		val, ok := replicaset.Annotations[deploymentRevision]
-		if ok && val == generation {
-			return &replicaset, nil
-		}
-	}
-	return nil, fmt.Errorf("could not find replicaset for deployment '%s' gen '%v'", dep.Name, generation)
-}
-
-func makePrometheusClientForCluster(namespace string, portname string) (*promClient, error) {
+func makePrometheusClientForCluster(namespace string, portname string, p PrometheusOptions) (*promClient, error) {
 	config, _, err := findConfig()
 	if err != nil {
 		return nil, err
@@ -149,6 +202,11 @@ func makePrometheusClientForCluster(namespace string, portname string) (*promCli
 	if err != nil {
 		return nil, err
 	}
+	if p.Tenant != "" {
+		headers := http.Header{}
+		headers.Set(tenantHeader, p.Tenant)
+		transport = &headerRoundTripper{headers: headers, next: transport}
+	}
 
 	var httpClient *http.Client
 	if transport != http.DefaultTransport {
@@ -156,6 +214,9 @@ func makePrometheusClientForCluster(namespace string, portname string) (*promCli
 		if config.Timeout > 0 {
 			httpClient.Timeout = config.Timeout
 		}
+		if p.Timeout > 0 {
+			httpClient.Timeout = p.Timeout
+		}
 	}
 
 	u, err := url.Parse(promurl)
@@ -176,38 +237,58 @@ func queryPrometheus(ctx context.Context, client *promClient, query string, ts t
 	return result, err
 }
 
+// detectMode finds the source of cpu usage. User-defined queries are reported as custom. Otherwise
+// the kube-prometheus recording rules are preferred, newer versions record sum_irate and older
+// ones sum_rate. Without the rules the rate is computed from the raw cAdvisor metrics with
+// subqueries.
 func (o *Options) detectMode(ctx context.Context) (string, error) {
-	now := time.Now()
-
-	cpuUsage := `node_namespace_pod_container:container_cpu_usage_seconds_total:%s`
-
-	request := fmt.Sprintf(cpuUsage, "sum_irate")
-	response, err := queryPrometheus(ctx, o.promClient, request, now)
-	if err != nil {
-		return "", fmt.Errorf("error detecting mode %w", err)
-	}
-	asSamples, ok := response.(prommodel.Vector)
-	if !ok {
-		return "", fmt.Errorf("error converting response to vector")
-	}
-
-	if len(asSamples) > 0 {
-		return "sum_irate", nil
+	if o.Queries.Detect != "" {
+		response, err := queryPrometheus(ctx, o.promClient, o.detectQuery(), o.at)
+		if err != nil {
+			return "", fmt.Errorf("error detecting mode %w", err)
+		}
+		asSamples, ok := response.(prommodel.Vector)
+		if !ok {
+			return "", fmt.Errorf("error converting response to vector")
+		}
+		if len(asSamples) == 0 {
+			return "", fmt.Errorf("custom detection query returned no data")
+		}
 	}
-
-	request = fmt.Sprintf(cpuUsage, "sum_rate")
-	response, err = queryPrometheus(ctx, o.promClient, request, now)
+	// the detection query only checks that the metrics of the templates exist, the built-in cpu
+	// queries still need the mode
+	if o.Queries.cpuOverridden() {
+		return ModeCustom, nil
+	}
+
+	modes := []string{ModeSumIrate, ModeSumRate, ModeRaw}
+	found, err := o.detect(ctx,
+		func(selector string, lookback string) string {
+			return fmt.Sprintf(cpuUsage, ModeSumIrate, selector, lookback)
+		},
+		func(selector string, lookback string) string {
+			return fmt.Sprintf(cpuUsage, ModeSumRate, selector, lookback)
+		},
+		func(selector string, lookback string) string {
+			return fmt.Sprintf(rawCPUUsage, selector, lookback)
+		},
+	)
 	if err != nil {
 		return "", fmt.Errorf("error detecting mode %w", err)
 	}
-	asSamples, ok = response.(prommodel.Vector)
-	if !ok {
-		return "", fmt.Errorf("error converting response to vector")
+	if found < 0 {
+		return "", fmt.Errorf("could not find cpu usage metrics")
 	}
-	if len(asSamples) > 0 {
-		return "sum_rate", nil
+	return modes[found], nil
+}
+
+// cpuUsageRange returns a range vector of the cpu usage of the containers matching the selector
+// over the lookback window.
+func (o *Options) cpuUsageRange(selector string) string {
+	if o.mode == ModeRaw {
+		return fmt.Sprintf(rawCPUUsageRange, selector, o.Window)
 	}
-	return "", fmt.Errorf("could not find cpu mode")
+	return fmt.Sprintf(ruleCPUUsageRange, o.mode, selector, o.Window)
 }
 
 func (c *promClient) URL(ep string, args map[string]string) *url.URL {
@@ -228,6 +309,19 @@ func (c *promClient) Do(ctx context.Context, req *http.Request) (*http.Response,
 	if ctx != nil {
 		req = req.WithContext(ctx)
 	}
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	if c.inFlight != nil {
+		select {
+		case c.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		defer func() { <-c.inFlight }()
+	}
 	resp, err := c.client.Do(req)
 	defer func() {
 		if resp != nil {
@@ -273,70 +367,6 @@ func byteCountSI(b int64) string {
 		float64(b)/float64(div), "kMGTPE"[exp])
 }
 
-func (o *Options) findPods(ctx context.Context, namespace string, selector string) (prometheusMetrics, error) {
-	final := prometheusMetrics{
-		LimitCPU:   make(map[string]float64),
-		LimitMem:   make(map[string]float64),
-		RequestCPU: make(map[string]float64),
-		RequestMem: make(map[string]float64),
-	}
-
-	pods, err := o.Client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector,
-	})
-	if err != nil {
-		return final, err
-	}
-
-	totalLimitCPU := make(map[string][]float64)
-	totalLimitMem := make(map[string][]float64)
-	totalRequestCPU := make(map[string][]float64)
-	totalRequestMem := make(map[string][]float64)
-
-	for _, pod := range pods.Items {
-		output, err := o.queryPrometheusForPod(ctx, o.promClient, pod)
-		if err != nil {
-			return final, err
-		}
-		for k, v := range output.RequestCPU {
-			totalRequestCPU[k] = append(totalRequestCPU[k], v)
-		}
-		for k, v := range output.RequestMem {
-			totalRequestMem[k] = append(totalRequestMem[k], v)
-		}
-		for k, v := range output.LimitCPU {
-			totalLimitCPU[k] = append(totalLimitCPU[k], v)
-		}
-		for k, v := range output.LimitMem {
-			totalLimitMem[k] = append(totalLimitMem[k], v)
-		}
-	}
-
-	for k, v := range totalRequestCPU {
-		scale := 10
-		value := float64Peak(v)
-		if value < 0.01 {
-			scale = 100
-		}
-		final.RequestCPU[k] = math.Ceil(value*float64(scale)) / float64(scale)
-	}
-	for k, v := range totalRequestMem {
-		final.RequestMem[k] = math.Ceil(float64Peak(v)/100) * 100
-	}
-	for k, v := range totalLimitCPU {
-		scale := 10
-		value := float64Peak(v)
-		if value < 0.01 {
-			scale = 100
-		}
-		final.LimitCPU[k] = math.Ceil(value*float64(scale)) / float64(scale)
-	}
-	for k, v := range totalLimitMem {
-		final.LimitMem[k] = math.Ceil(float64Peak(v)/100) * 100
-	}
-	return final, nil
-}
-
 func buildUsedNamespaces(ctx context.Context, o *Options) (string, error) {
 	if o.NamespaceSelector != "" {
 		namespaces, err := o.Client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
@@ -361,6 +391,18 @@ func buildUsedNamespaces(ctx context.Context, o *Options) (string, error) {
 }
 
 func makeClientForCluster(ctx context.Context, o *Options) (*promClient, error) {
+	client, err := makeUnlimitedClientForCluster(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	client.limit(o.Prometheus)
+	return client, nil
+}
+
+func makeUnlimitedClientForCluster(ctx context.Context, o *Options) (*promClient, error) {
+	if o.Prometheus.URL != "" {
+		return makePrometheusClientForURL(o.Prometheus)
+	}
 	promService, err := o.Client.CoreV1().Services("").List(ctx, metav1.ListOptions{
 		LabelSelector: "operated-prometheus=true",
 	})
@@ -368,111 +410,108 @@ func makeClientForCluster(ctx context.Context, o *Options) (*promClient, error)
 		return nil, err
 	}
 	if len(promService.Items) == 0 || len(promService.Items[0].Spec.Ports) == 0 {
-		return nil, fmt.Errorf("prometheus-operator not detected")
+		return nil, errPrometheusNotDetected
 	}
-	return makePrometheusClientForCluster(promService.Items[0].Namespace, promService.Items[0].Spec.Ports[0].Name)
+	return makePrometheusClientForCluster(promService.Items[0].Namespace, promService.Items[0].Spec.Ports[0].Name, o.Prometheus)
 }
 
-func (o *Options) handleDeployments(ctx context.Context, namespace string, data [][]string) ([][]string, float64, float64, error) {
+func (o *Options) handleDeployments(ctx context.Context, namespace string, metrics MetricsSource, recommendations []Recommendation) ([]Recommendation, error) {
 	deployments, err := o.Client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
-	totalCPUSave := float64(0.00)
-	totalMemSave := float64(0.00)
-
 	for _, deployment := range deployments.Items {
-		selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		workload := Workload{Namespace: deployment.Namespace, Kind: KindDeployment, Name: deployment.Name}
+		resources, err := o.recommend(ctx, metrics, workload)
 		if err != nil {
-			return nil, 0, 0, err
+			return nil, err
 		}
+		recommendations = o.analyzeDeployment(recommendations, deployment, resources)
+	}
+	return recommendations, nil
+}
 
-		replicasets, err := o.Client.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
-			LabelSelector: selector.String(),
-		})
-		if err != nil {
-			return nil, 0, 0, err
-		}
+func (o *Options) handleStatefulsets(ctx context.Context, namespace string, metrics MetricsSource, recommendations []Recommendation) ([]Recommendation, error) {
+	statefulSets, err := o.Client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
 
-		replicaset, err := findReplicaset(replicasets, deployment)
+	for _, statefulSet := range statefulSets.Items {
+		workload := Workload{Namespace: statefulSet.Namespace, Kind: KindStatefulSet, Name: statefulSet.Name}
+		resources, err := o.recommend(ctx, metrics, workload)
 		if err != nil {
-			return nil, 0, 0, err
+			return nil, err
 		}
+		recommendations = o.analyzeStatefulset(recommendations, statefulSet, resources)
+	}
+	return recommendations, nil
+}
 
-		selector, err = metav1.LabelSelectorAsSelector(replicaset.Spec.Selector)
-		if err != nil {
-			return nil, 0, 0, err
-		}
+func (o *Options) handleDaemonsets(ctx context.Context, namespace string, metrics MetricsSource, recommendations []Recommendation) ([]Recommendation, error) {
+	daemonSets, err := o.Client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
 
-		final, err := o.findPods(ctx, deployment.Namespace, selector.String())
+	for _, daemonSet := range daemonSets.Items {
+		workload := Workload{Namespace: daemonSet.Namespace, Kind: KindDaemonSet, Name: daemonSet.Name}
+		resources, err := o.recommend(ctx, metrics, workload)
 		if err != nil {
-			return nil, 0, 0, err
+			return nil, err
 		}
+		recommendations = o.analyzeDaemonSet(recommendations, daemonSet, resources)
+	}
+	return recommendations, nil
+}
 
-		var cpuSave float64
-		var memSave float64
-		data, cpuSave, memSave = o.analyzeDeployment(data, deployment, final)
-		totalCPUSave += cpuSave
-		totalMemSave += memSave
+func ownedByCronJob(job batchv1.Job) bool {
+	for _, owner := range job.OwnerReferences {
+		if owner.Kind == "CronJob" {
+			return true
+		}
 	}
-	return data, totalCPUSave, totalMemSave, nil
+	return false
 }
 
-func (o *Options) handleStatefulsets(ctx context.Context, namespace string, data [][]string) ([][]string, float64, float64, error) {
-	statefulSets, err := o.Client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+// handleCronJobs analyzes cronjobs using the pods of their jobs. With the owners history also runs
+// whose jobs have already been removed are included.
+func (o *Options) handleCronJobs(ctx context.Context, namespace string, metrics MetricsSource, recommendations []Recommendation) ([]Recommendation, error) {
+	cronJobs, err := o.Client.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
-	totalCPUSave := float64(0.00)
-	totalMemSave := float64(0.00)
-
-	for _, statefulSet := range statefulSets.Items {
-		selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
+	for _, cronJob := range cronJobs.Items {
+		workload := Workload{Namespace: cronJob.Namespace, Kind: KindCronJob, Name: cronJob.Name}
+		resources, err := o.recommend(ctx, metrics, workload)
 		if err != nil {
-			return nil, 0, 0, err
+			return nil, err
 		}
-
-		final, err := o.findPods(ctx, statefulSet.Namespace, selector.String())
-		if err != nil {
-			return nil, 0, 0, err
-		}
-
-		var cpuSave float64
-		var memSave float64
-		data, cpuSave, memSave = o.analyzeStatefulset(data, statefulSet, final)
-		totalCPUSave += cpuSave
-		totalMemSave += memSave
+		recommendations = o.analyzeCronJob(recommendations, cronJob, resources)
 	}
-	return data, totalCPUSave, totalMemSave, nil
+	return recommendations, nil
 }
 
-func (o *Options) handleDaemonsets(ctx context.Context, namespace string, data [][]string) ([][]string, float64, float64, error) {
-	daemonSets, err := o.Client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+func (o *Options) handleJobs(ctx context.Context, namespace string, metrics MetricsSource, recommendations []Recommendation) ([]Recommendation, error) {
+	jobs, err := o.Client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
-	totalCPUSave := float64(0.00)
-	totalMemSave := float64(0.00)
-
-	for _, daemonSets := range daemonSets.Items {
-		selector, err := metav1.LabelSelectorAsSelector(daemonSets.Spec.Selector)
-		if err != nil {
-			return nil, 0, 0, err
+	for _, job := range jobs.Items {
+		// jobs created by cronjobs are analyzed as part of their cronjob
+		if ownedByCronJob(job) {
+			continue
 		}
 
-		final, err := o.findPods(ctx, daemonSets.Namespace, selector.String())
+		workload := Workload{Namespace: job.Namespace, Kind: KindJob, Name: job.Name}
+		resources, err := o.recommend(ctx, metrics, workload)
 		if err != nil {
-			return nil, 0, 0, err
+			return nil, err
 		}
-
-		var cpuSave float64
-		var memSave float64
-		data, cpuSave, memSave = o.analyzeDaemonSet(data, daemonSets, final)
-		totalCPUSave += cpuSave
-		totalMemSave += memSave
+		recommendations = o.analyzeJob(recommendations, job, resources)
 	}
-	return data, totalCPUSave, totalMemSave, nil
+	return recommendations, nil
 }
@@ -0,0 +1,267 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func containerSample(namespace, pod, container string, value float64) *prommodel.Sample {
+	return &prommodel.Sample{
+		Metric: prommodel.Metric{"namespace": prommodel.LabelValue(namespace), "pod": prommodel.LabelValue(pod), "container": prommodel.LabelValue(container)},
+		Value:  prommodel.SampleValue(value),
+	}
+}
+
+func TestAggregateSamples(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		samples  prommodel.Vector
+		expected map[containerKey]float64
+	}{
+		{
+			name: "app and sidecar",
+			samples: prommodel.Vector{
+				containerSample("ns", "web-1", "app", 1.5),
+				containerSample("ns", "web-1", "sidecar", 0.01),
+			},
+			expected: map[containerKey]float64{
+				{Namespace: "ns", Pod: "web-1", Container: "app"}:     1.5,
+				{Namespace: "ns", Pod: "web-1", Container: "sidecar"}: 0.01,
+			},
+		},
+		{
+			name: "several series of a container",
+			samples: prommodel.Vector{
+				containerSample("ns", "web-1", "app", 0.5),
+				containerSample("ns", "web-1", "app", 2),
+				containerSample("ns", "web-1", "app", 1),
+				containerSample("ns", "web-1", "sidecar", 0.02),
+				containerSample("ns", "web-1", "sidecar", 0.01),
+			},
+			expected: map[containerKey]float64{
+				{Namespace: "ns", Pod: "web-1", Container: "app"}:     2,
+				{Namespace: "ns", Pod: "web-1", Container: "sidecar"}: 0.02,
+			},
+		},
+		{
+			name: "nan values",
+			samples: prommodel.Vector{
+				containerSample("ns", "web-1", "app", math.NaN()),
+				containerSample("ns", "web-1", "app", 0.5),
+				containerSample("ns", "web-1", "sidecar", math.NaN()),
+			},
+			expected: map[containerKey]float64{
+				{Namespace: "ns", Pod: "web-1", Container: "app"}: 0.5,
+			},
+		},
+		{
+			name: "same pod in two namespaces",
+			samples: prommodel.Vector{
+				containerSample("ns1", "web-1", "app", 1),
+				containerSample("ns2", "web-1", "app", 3),
+			},
+			expected: map[containerKey]float64{
+				{Namespace: "ns1", Pod: "web-1", Container: "app"}: 1,
+				{Namespace: "ns2", Pod: "web-1", Container: "app"}: 3,
+			},
+		},
+		{
+			name:     "no samples",
+			expected: map[containerKey]float64{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := aggregateSamples(tc.samples); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEvaluationTime(t *testing.T) {
+	for _, tc := range []struct {
+		at       string
+		expected time.Time
+		err      string
+	}{
+		{"2026-01-02T03:04:05Z", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ""},
+		{"2026-01-02T05:04:05+02:00", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ""},
+		{"1767323045", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ""},
+		{"1767323045.5", time.Date(2026, 1, 2, 3, 4, 5, 500000000, time.UTC), ""},
+		{"2026-01-02", time.Time{}, "invalid evaluation time '2026-01-02', expected RFC 3339 or unix timestamp"},
+		{"yesterday", time.Time{}, "invalid evaluation time 'yesterday'"},
+	} {
+		t.Run(tc.at, func(t *testing.T) {
+			actual, err := evaluationTime(tc.at)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !actual.Equal(tc.expected) {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+
+	now, err := evaluationTime("")
+	if err != nil || time.Since(now) > time.Minute {
+		t.Errorf("expected now, got %s, %v", now, err)
+	}
+}
+
+func TestAnalyzeWindow(t *testing.T) {
+	for _, window := range []string{"3", "1 week", "0d", "-1d"} {
+		t.Run(window, func(t *testing.T) {
+			o := &Options{Window: window, Namespaces: "ns", Client: fake.NewClientset(), Metrics: fakeSource{}, Out: io.Discard}
+			o.loadDefaults()
+			_, err := o.analyze(context.Background())
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("invalid window '%s'", window)) {
+				t.Errorf("expected invalid window, got %v", err)
+			}
+		})
+	}
+}
+
+// queryServer points the options to a Prometheus whose instant queries return the vector result
+// gives for the query and returns the queries in the order they were received.
+func queryServer(t *testing.T, o *Options, result func(query string) string) *[]string {
+	t.Helper()
+	var mu sync.Mutex
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		query := r.Form.Get("query")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + result(query) + `}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	o.Prometheus.URL = server.URL
+	o.loadDefaults()
+	client, err := makePrometheusClientForURL(o.Prometheus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.promClient, o.at = client, time.Now()
+	return &queries
+}
+
+// withData returns a result function which returns a sample for the queries containing any of the
+// parts.
+func withData(parts ...string) func(string) string {
+	return func(query string) string {
+		for _, part := range parts {
+			if strings.Contains(query, part) {
+				return `[{"metric":{},"value":[0,"1"]}]`
+			}
+		}
+		return "[]"
+	}
+}
+
+func TestDetectMode(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		window  string
+		data    []string
+		mode    string
+		queries []string
+		err     string
+	}{
+		{"recent sum_irate", "1w", []string{`sum_irate{namespace=~"a|b", cluster="prod"}[1h]`}, ModeSumIrate, []string{
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[1h]))`,
+		}, ""},
+		{"sum_rate in the window", "1w", []string{`sum_rate{namespace=~"a|b", cluster="prod"}[1w]`}, ModeSumRate, []string{
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(container_cpu_usage_seconds_total{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[1w]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace=~"a|b", cluster="prod"}[1w]))`,
+		}, ""},
+		{"raw", "1w", []string{`container_cpu_usage_seconds_total{namespace=~"a|b", cluster="prod"}[1h]`}, ModeRaw, []string{
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(container_cpu_usage_seconds_total{namespace=~"a|b", cluster="prod"}[1h]))`,
+		}, ""},
+		// only cronjobs which have not run recently
+		{"old sum_irate", "1w", []string{`sum_irate{namespace=~"a|b", cluster="prod"}[1w]`}, ModeSumIrate, []string{
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(container_cpu_usage_seconds_total{namespace=~"a|b", cluster="prod"}[1h]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[1w]))`,
+		}, ""},
+		{"short window", "30m", []string{"sum_rate"}, ModeSumRate, []string{
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace=~"a|b", cluster="prod"}[30m]))`,
+			`count(last_over_time(node_namespace_pod_container:container_cpu_usage_seconds_total:sum_rate{namespace=~"a|b", cluster="prod"}[30m]))`,
+		}, ""},
+		{"no metrics", "1w", nil, "", nil, "could not find cpu usage metrics"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{Window: tc.window, usedNamespaces: "a,b", Prometheus: PrometheusOptions{Matchers: []string{`cluster="prod"`}}}
+			queries := queryServer(t, o, withData(tc.data...))
+			mode, err := o.detectMode(context.Background())
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode != tc.mode {
+				t.Errorf("expected mode %s, got %s", tc.mode, mode)
+			}
+			if !reflect.DeepEqual(*queries, tc.queries) {
+				t.Errorf("expected queries\n%s\ngot\n%s", strings.Join(tc.queries, "\n"), strings.Join(*queries, "\n"))
+			}
+		})
+	}
+}
+
+func TestDetectHistory(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    []string
+		history string
+		queries int
+	}{
+		{"recent owners", []string{`kube_pod_owner{namespace=~"ns"}[1h]`}, HistoryOwners, 1},
+		{"owners in the window", []string{`kube_pod_owner{namespace=~"ns"}[1w]`}, HistoryOwners, 2},
+		{"no owners", nil, HistoryPods, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{usedNamespaces: "ns"}
+			queries := queryServer(t, o, withData(tc.data...))
+			history, err := o.detectHistory(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if history != tc.history || len(*queries) != tc.queries {
+				t.Errorf("expected history %s with %d queries, got %s with %v", tc.history, tc.queries, history, *queries)
+			}
+		})
+	}
+}